@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// runBootstrapAdmin gives the admin role to the account with the given email, creating the
+// account first when it does not exist yet. It refuses to run once an admin exists, further
+// admins are assigned through the admin API.
+//
+//	main bootstrap-admin -email admin@example.com [-name "Site Admin"]
+//
+// The password of a new account is read from BOOTSTRAP_ADMIN_PASSWORD so it stays out of the shell history
+func runBootstrapAdmin(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the admin account")
+	name := flags.String("name", "Administrator", "name of the admin account, when it has to be created")
+	force := flags.Bool("force", false, "run even if an admin already exists")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return fmt.Errorf("-email is not a valid email: %q", *email)
+	}
+
+	ctx := context.Background()
+	db := connectToDB(cfg.Database)
+	defer db.Close()
+
+	userRepo := user.NewUserRepo(db)
+	roleRepo := role.NewRoleRepo(db)
+
+	adminCount, err := roleRepo.CountUsersWithRole(ctx, role.RoleAdmin)
+	if err != nil {
+		return errors.Wrap(err, "CountUsersWithRole error")
+	}
+	if adminCount > 0 && !*force {
+		return fmt.Errorf("%d admin(s) already exist, use -force to add another one", adminCount)
+	}
+
+	admin, err := userRepo.GetUserByCredential(ctx, "email", *email)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "GetUserByCredential error")
+	}
+
+	if err == sql.ErrNoRows {
+		password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+		if len(password) < user.PasswordMinLength || len(password) > user.PasswordMaxLength {
+			return fmt.Errorf("BOOTSTRAP_ADMIN_PASSWORD must be between %d and %d characters long", user.PasswordMinLength, user.PasswordMaxLength)
+		}
+
+		hashedPassword, err := buildPasswordHasher(cfg.PasswordHasher, cfg.BcryptSalt).Hash(password)
+		if err != nil {
+			return errors.Wrap(err, "Hash error")
+		}
+
+		admin = user.User{
+			ID:       uuid.NewString(),
+			Name:     *name,
+			Email:    sql.NullString{String: *email, Valid: true},
+			Password: hashedPassword,
+		}
+		err = userRepo.CreateUser(ctx, nil, admin)
+		if err != nil {
+			return errors.Wrap(err, "CreateUser error")
+		}
+
+		log.Printf("created user %s", admin.ID)
+	}
+
+	err = roleRepo.SetUserRole(ctx, nil, admin.ID, role.RoleAdmin)
+	if err != nil {
+		return errors.Wrap(err, "SetUserRole error")
+	}
+
+	log.Printf("user %s (%s) is now an admin. Existing sessions get the new permissions on their next token refresh", admin.ID, *email)
+	return nil
+}
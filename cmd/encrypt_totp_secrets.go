@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/twofactor"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/encryption"
+	"github.com/pkg/errors"
+)
+
+// runEncryptTOTPSecrets encrypts the TOTP secrets stored in plaintext before secrets were
+// encrypted with TOTP_ENCRYPTION_KEY. Running it again only picks up what is left.
+//
+//	main encrypt-totp-secrets [-dry-run]
+func runEncryptTOTPSecrets(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("encrypt-totp-secrets", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	totpCipher := buildTOTPCipher(cfg.TOTPEncryptionKey)
+
+	ctx := context.Background()
+	db := connectToDB(cfg.Database)
+	defer db.Close()
+
+	twoFactorRepo := twofactor.NewTwoFactorRepo(db)
+
+	enrollments, err := twoFactorRepo.ListPlaintextTOTP(ctx, encryption.Prefix)
+	if err != nil {
+		return errors.Wrap(err, "ListPlaintextTOTP error")
+	}
+
+	var updated, skipped int
+	for _, enrollment := range enrollments {
+		if *dryRun {
+			log.Printf("user %s: secret would be encrypted", enrollment.UserID)
+			updated++
+			continue
+		}
+
+		encryptedSecret, err := totpCipher.Encrypt(enrollment.Secret, enrollment.UserID)
+		if err != nil {
+			return errors.Wrap(err, "Encrypt error")
+		}
+
+		replaced, err := twoFactorRepo.ReplaceTOTPSecret(ctx, nil, enrollment.UserID, enrollment.Secret, encryptedSecret)
+		if err != nil {
+			return errors.Wrap(err, "ReplaceTOTPSecret error")
+		}
+		// the user enrolled again or disabled 2FA meanwhile, and a new secret is encrypted already
+		if !replaced {
+			log.Printf("user %s: secret changed meanwhile, skipped", enrollment.UserID)
+			skipped++
+			continue
+		}
+
+		log.Printf("user %s: secret encrypted", enrollment.UserID)
+		updated++
+	}
+
+	log.Printf("%d of %d secrets encrypted, %d skipped", updated, len(enrollments), skipped)
+	return nil
+}
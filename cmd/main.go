@@ -6,16 +6,33 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/ahmadnaufal/openidea-segokuning/internal/account"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/admin"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/export"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/friend"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/identity"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/image"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/loginguard"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/personaltoken"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/post"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/privacy"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/profile"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/session"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/twofactor"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/verification"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/encryption"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/middleware"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/notifier"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/oidc"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/s3"
 
 	"github.com/ansrivas/fiberprometheus/v2"
@@ -31,10 +48,36 @@ import (
 func main() {
 	cfg := config.InitializeConfig()
 
+	// subcommands do their job and exit without starting the server
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "bootstrap-admin":
+			err = runBootstrapAdmin(cfg, os.Args[2:])
+		case "normalize-phones":
+			err = runNormalizePhones(cfg, os.Args[2:])
+		case "encrypt-totp-secrets":
+			err = runEncryptTOTPSecrets(cfg, os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			log.Println(os.Args[1], "failed: ", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: config.DefaultErrorHandler(),
 		Prefork:      false,
 		Concurrency:  1024 * 1024,
+		// the client IP drives the login lockouts, the audit log and the session list
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          buildTrustedProxies(cfg.ProxyHeader, cfg.TrustedProxies),
+		EnableIPValidation:      true,
 	})
 
 	app.Use(logger.New())
@@ -43,13 +86,38 @@ func main() {
 	// custom middleware to set all method not allowed response to not found
 	app.Use(middleware.CustomMiddleware404())
 
-	jwtProvider := jwt.NewJWTProvider(cfg.JWTSecret)
-
 	db := connectToDB(cfg.Database)
 
 	userRepo := user.NewUserRepo(db)
 	friendRepo := friend.NewFriendRepo(db)
 	postRepo := post.NewPostRepo(db)
+	sessionRepo := session.NewSessionRepo(db)
+	codeRepo := verification.NewCodeRepo(db)
+	twoFactorRepo := twofactor.NewTwoFactorRepo(db)
+	imageRepo := image.NewImageRepo(db)
+	accountRepo := account.NewAccountRepo(db)
+	exportRepo := export.NewExportRepo(db)
+	roleRepo := role.NewRoleRepo(db)
+	moderationRepo := admin.NewModerationRepo(db)
+	auditRepo := audit.NewAuditRepo(db)
+	identityRepo := identity.NewIdentityRepo(db)
+	personalTokenRepo := personaltoken.NewPersonalTokenRepo(db)
+	privacyRepo := privacy.NewPrivacyRepo(db)
+
+	revoker := session.NewRevoker(&sessionRepo, time.Duration(cfg.TokenRevocationCacheSeconds)*time.Second)
+
+	jwtProvider, err := jwt.NewJWTProvider(jwt.ProviderConfig{
+		Secret:      cfg.JWTSecret,
+		KeysDir:     cfg.JWTKeysDir,
+		ActiveKeyID: cfg.JWTActiveKeyID,
+		Issuer:      cfg.JWTIssuer,
+		Audience:    cfg.JWTAudience,
+	})
+	if err != nil {
+		panic(err)
+	}
+	jwtProvider.SetRevocationChecker(revoker)
+	jwtProvider.SetPersonalTokenAuthenticator(personaltoken.NewAuthenticator(&personalTokenRepo))
 
 	trxProvider := config.NewTransactionProvider(db)
 
@@ -60,33 +128,121 @@ func main() {
 
 	s3Provider := s3.NewS3Provider(awsCfg, cfg.S3.Bucket, cfg.S3.Region, cfg.S3.ID, cfg.S3.SecretKey)
 
-	imageHandler := image.NewImageHandler(&s3Provider)
+	emailNotifier, smsNotifier := buildNotifiers(cfg.Notifier)
+	auditRecorder := audit.NewRecorder(&auditRepo)
+	loginGuard := buildLoginGuard(cfg.LoginGuard, db)
+
+	imageHandler := image.NewImageHandler(image.ImageHandlerConfig{
+		S3Provider: &s3Provider,
+		ImageRepo:  &imageRepo,
+	})
 	userHandler := user.NewUserHandler(user.UserHandlerConfig{
-		UserRepo:    &userRepo,
-		JwtProvider: &jwtProvider,
-		SaltCost:    cfg.BcryptSalt,
+		UserRepo:               &userRepo,
+		SessionRepo:            &sessionRepo,
+		CodeRepo:               &codeRepo,
+		TwoFactorRepo:          &twoFactorRepo,
+		RoleRepo:               &roleRepo,
+		IdentityRepo:           &identityRepo,
+		AuditRecorder:          auditRecorder,
+		TxProvider:             &trxProvider,
+		JwtProvider:            &jwtProvider,
+		Revoker:                revoker,
+		LoginGuard:             loginGuard,
+		EmailNotifier:          emailNotifier,
+		SMSNotifier:            smsNotifier,
+		PasswordHasher:         buildPasswordHasher(cfg.PasswordHasher, cfg.BcryptSalt),
+		TOTPCipher:             buildTOTPCipher(cfg.TOTPEncryptionKey),
+		RefreshTokenExpiry:     time.Duration(cfg.RefreshTokenExpiryHours) * time.Hour,
+		VerificationCodeExpiry: time.Duration(cfg.VerificationCodeExpiryMinutes) * time.Minute,
+		DeletionGracePeriod:    time.Duration(cfg.AccountDeletionGraceHours) * time.Hour,
+		OIDCProviders:          buildOIDCProviders(cfg.OIDC),
+		OIDCLoginStateExpiry:   time.Duration(cfg.OIDC.LoginStateMinutes) * time.Minute,
 	})
 	friendHandler := friend.NewFriendHandler(friend.FriendHandlerConfig{
 		UserRepo:   &userRepo,
 		FriendRepo: &friendRepo,
 		TxProvider: &trxProvider,
 	})
+	profileHandler := profile.NewProfileHandler(profile.ProfileHandlerConfig{
+		UserRepo:    &userRepo,
+		FriendRepo:  &friendRepo,
+		PrivacyRepo: &privacyRepo,
+	})
+	adminHandler := admin.NewAdminHandler(admin.AdminHandlerConfig{
+		UserRepo:       &userRepo,
+		ModerationRepo: &moderationRepo,
+		RoleRepo:       &roleRepo,
+		TxProvider:     &trxProvider,
+		Revoker:        revoker,
+		AuditRecorder:  auditRecorder,
+	})
+	auditHandler := audit.NewAuditHandler(audit.AuditHandlerConfig{
+		AuditRepo: &auditRepo,
+	})
+	personalTokenHandler := personaltoken.NewPersonalTokenHandler(personaltoken.PersonalTokenHandlerConfig{
+		TokenRepo:     &personalTokenRepo,
+		AuditRecorder: auditRecorder,
+	})
+	privacyHandler := privacy.NewPrivacyHandler(privacy.PrivacyHandlerConfig{
+		PrivacyRepo:   &privacyRepo,
+		AuditRecorder: auditRecorder,
+	})
+	exportHandler := export.NewExportHandler(export.ExportHandlerConfig{
+		ExportRepo:  &exportRepo,
+		S3Provider:  &s3Provider,
+		DownloadTTL: time.Duration(cfg.ExportDownloadURLMinutes) * time.Minute,
+	})
 	postHandler := post.NewPostHandler(post.PostHandlerConfig{
-		PostRepo:   &postRepo,
-		TxProvider: &trxProvider,
-		FriendRepo: &friendRepo,
+		PostRepo:    &postRepo,
+		TxProvider:  &trxProvider,
+		FriendRepo:  &friendRepo,
+		PrivacyRepo: &privacyRepo,
 	})
 
 	imageHandler.RegisterRoute(app, jwtProvider)
 	userHandler.RegisterRoute(app, jwtProvider)
 	friendHandler.RegisterRoute(app, jwtProvider)
 	postHandler.RegisterRoute(app, jwtProvider)
+	exportHandler.RegisterRoute(app, jwtProvider)
+	profileHandler.RegisterRoute(app, jwtProvider)
+	adminHandler.RegisterRoute(app, jwtProvider)
+	auditHandler.RegisterRoute(app, jwtProvider)
+	personalTokenHandler.RegisterRoute(app, jwtProvider)
+	privacyHandler.RegisterRoute(app, jwtProvider)
+
+	// public keys for other services to verify our tokens
+	app.Get("/.well-known/jwks.json", jwtProvider.JWKSHandler())
 
 	// setup instrumentation
 	prometheus := fiberprometheus.New("segokuning")
 	prometheus.RegisterAt(app, "/metrics")
 	app.Use(prometheus.Middleware)
 
+	// background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	purger := account.NewPurger(account.PurgerConfig{
+		AccountRepo: &accountRepo,
+		SessionRepo: &sessionRepo,
+		TxProvider:  &trxProvider,
+		S3Provider:  &s3Provider,
+		Interval:    time.Duration(cfg.AccountPurgeIntervalMinutes) * time.Minute,
+		BatchSize:   50,
+	})
+	go purger.Run(jobsCtx)
+
+	exportWorker := export.NewWorker(export.WorkerConfig{
+		ExportRepo: &exportRepo,
+		UserRepo:   &userRepo,
+		FriendRepo: &friendRepo,
+		PostRepo:   &postRepo,
+		S3Provider: &s3Provider,
+		Interval:   time.Duration(cfg.ExportWorkerIntervalSeconds) * time.Second,
+		Retention:  time.Duration(cfg.ExportRetentionHours) * time.Hour,
+	})
+	go exportWorker.Run(jobsCtx)
+
 	addr := fmt.Sprintf(":%s", cfg.AppPort)
 
 	sig := make(chan os.Signal, 1)
@@ -103,6 +259,7 @@ func main() {
 	receivedSignal := <-sig
 
 	log.Printf("received %v. Stopping app...", receivedSignal)
+	stopJobs()
 	if err := app.Shutdown(); err != nil {
 		log.Println("failed to shutdown server: ", err)
 		os.Exit(1)
@@ -135,3 +292,141 @@ func connectToDB(dbCfg config.DatabaseConfig) *sqlx.DB {
 
 	return db
 }
+
+func buildNotifiers(notifierCfg config.NotifierConfig) (notifier.Notifier, notifier.Notifier) {
+	newLogNotifier := func(channel string) notifier.Notifier {
+		if notifierCfg.LogFile == "" {
+			return notifier.NewLogNotifier(channel)
+		}
+
+		fileNotifier, err := notifier.NewFileNotifier(channel, notifierCfg.LogFile)
+		if err != nil {
+			panic(err)
+		}
+
+		return fileNotifier
+	}
+
+	var emailNotifier notifier.Notifier
+	switch notifierCfg.EmailDriver {
+	case "smtp":
+		emailNotifier = notifier.NewSMTPNotifier(
+			notifierCfg.SMTPHost, notifierCfg.SMTPPort,
+			notifierCfg.SMTPUsername, notifierCfg.SMTPPassword, notifierCfg.SMTPFrom,
+		)
+	default:
+		emailNotifier = newLogNotifier("email")
+	}
+
+	var smsNotifier notifier.Notifier
+	switch notifierCfg.SMSDriver {
+	case "http":
+		smsNotifier = notifier.NewSMSNotifier(notifierCfg.SMSGatewayURL, notifierCfg.SMSGatewayToken, notifierCfg.SMSSender)
+	default:
+		smsNotifier = newLogNotifier("sms")
+	}
+
+	return emailNotifier, smsNotifier
+}
+
+func buildLoginGuard(guardCfg config.LoginGuardConfig, db *sqlx.DB) *loginguard.Guard {
+	window := time.Duration(guardCfg.WindowMinutes) * time.Minute
+
+	var store loginguard.AttemptStore
+	switch guardCfg.Store {
+	case "postgres":
+		store = loginguard.NewPostgresStore(db)
+	default:
+		store = loginguard.NewMemoryStore(window)
+	}
+
+	basePolicy := loginguard.Policy{
+		BaseLockout: time.Duration(guardCfg.BaseLockoutSeconds) * time.Second,
+		MaxLockout:  time.Duration(guardCfg.MaxLockoutSeconds) * time.Second,
+		Window:      window,
+	}
+	credentialPolicy, ipPolicy := basePolicy, basePolicy
+	credentialPolicy.FreeAttempts = guardCfg.CredentialFreeAttempts
+	ipPolicy.FreeAttempts = guardCfg.IPFreeAttempts
+
+	return loginguard.NewGuard(store, credentialPolicy, ipPolicy)
+}
+
+// buildTrustedProxies parses TRUSTED_PROXIES. A proxy header without trusted proxies would never be read,
+// so that is refused instead of silently using the address of the load balancer for every client
+func buildTrustedProxies(proxyHeader, trustedProxies string) []string {
+	proxies := []string{}
+	for _, proxy := range strings.Split(trustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		proxies = append(proxies, proxy)
+	}
+
+	if proxyHeader != "" && len(proxies) == 0 {
+		panic("PROXY_HEADER needs TRUSTED_PROXIES, the addresses of the load balancers setting it")
+	}
+
+	return proxies
+}
+
+// buildOIDCProviders sets up the providers listed in OIDC_PROVIDERS from their OIDC_<NAME>_* variables
+func buildOIDCProviders(oidcCfg config.OIDCConfig) map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+
+	for _, name := range strings.Split(oidcCfg.Providers, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providerCfg := oidc.Config{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if providerCfg.IssuerURL == "" || providerCfg.ClientID == "" || providerCfg.RedirectURL == "" {
+			panic(fmt.Sprintf("oidc provider %s needs %sISSUER_URL, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix))
+		}
+
+		providers[name] = oidc.NewProvider(providerCfg)
+	}
+
+	return providers
+}
+
+// buildTOTPCipher refuses to start without a valid key, as 2FA secrets would otherwise be stored in plaintext
+func buildTOTPCipher(encodedKey string) *encryption.Cipher {
+	if encodedKey == "" {
+		panic("TOTP_ENCRYPTION_KEY must be set")
+	}
+
+	totpCipher, err := encryption.NewCipherFromBase64(encodedKey)
+	if err != nil {
+		panic(fmt.Sprintf("invalid TOTP_ENCRYPTION_KEY: %s", err))
+	}
+
+	return totpCipher
+}
+
+func buildPasswordHasher(hasherCfg config.PasswordHasherConfig, bcryptCost int) user.PasswordHasher {
+	argon2idHasher := user.NewArgon2idHasher(user.Argon2idParams{
+		Memory:      hasherCfg.Argon2MemoryKiB,
+		Iterations:  hasherCfg.Argon2Iterations,
+		Parallelism: hasherCfg.Argon2Parallelism,
+	})
+	bcryptHasher := user.NewBcryptHasher(bcryptCost)
+
+	switch hasherCfg.Algorithm {
+	case "bcrypt":
+		return user.NewMultiHasher(bcryptHasher, argon2idHasher)
+	default:
+		return user.NewMultiHasher(argon2idHasher, bcryptHasher)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/phone"
+	"github.com/pkg/errors"
+)
+
+// runNormalizePhones rewrites the phones stored before they were normalized into E.164.
+// Phones which do not parse, and phones which would end up equal to the phone of another
+// account, are reported and left as they are to be sorted out by hand.
+//
+//	main normalize-phones [-dry-run]
+func runNormalizePhones(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("normalize-phones", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db := connectToDB(cfg.Database)
+	defer db.Close()
+
+	userRepo := user.NewUserRepo(db)
+
+	users, err := userRepo.ListUsersWithPhone(ctx)
+	if err != nil {
+		return errors.Wrap(err, "ListUsersWithPhone error")
+	}
+
+	// owners of the stored phones, kept up to date as phones are rewritten
+	owners := map[string]string{}
+	for _, u := range users {
+		owners[u.Phone.String] = u.ID
+	}
+
+	var updated, skipped int
+	for _, u := range users {
+		number, err := phone.Normalize(u.Phone.String)
+		if err != nil {
+			log.Printf("user %s: cannot normalize %q: %s", u.ID, u.Phone.String, err)
+			skipped++
+			continue
+		}
+		if number == u.Phone.String {
+			continue
+		}
+
+		if owner, ok := owners[number]; ok && owner != u.ID {
+			log.Printf("user %s: %q normalizes to %s which belongs to user %s", u.ID, u.Phone.String, number, owner)
+			skipped++
+			continue
+		}
+
+		if !*dryRun {
+			err = userRepo.UpdatePhone(ctx, nil, u.ID, number)
+			if err != nil {
+				return errors.Wrap(err, "UpdatePhone error")
+			}
+		}
+
+		delete(owners, u.Phone.String)
+		owners[number] = u.ID
+		log.Printf("user %s: %q -> %s", u.ID, u.Phone.String, number)
+		updated++
+	}
+
+	log.Printf("%d of %d phones normalized, %d skipped", updated, len(users), skipped)
+	return nil
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS user_sessions (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP(0) DEFAULT NOW(),
+  updated_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS user_refresh_tokens (
+  id VARCHAR(48) PRIMARY KEY,
+  session_id VARCHAR(48) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_refresh_tokens_session_id ON user_refresh_tokens(session_id);
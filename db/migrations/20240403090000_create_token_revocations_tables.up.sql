@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+  jti VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_expires_at ON revoked_access_tokens(expires_at);
+
+-- every access token of the user issued before revoked_before is rejected ("log out everywhere")
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+  user_id VARCHAR(48) PRIMARY KEY,
+  revoked_before TIMESTAMP NOT NULL,
+  created_at TIMESTAMP(0) DEFAULT NOW(),
+  updated_at TIMESTAMP(0) DEFAULT NOW()
+);
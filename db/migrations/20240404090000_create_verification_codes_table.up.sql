@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS verification_codes (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  purpose VARCHAR(32) NOT NULL,
+  target VARCHAR(64) NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP NOT NULL,
+  consumed_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_verification_codes_user_id_purpose ON verification_codes(user_id, purpose);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP;
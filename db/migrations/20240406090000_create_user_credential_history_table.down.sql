@@ -0,0 +1 @@
+DROP TABLE IF EXISTS user_credential_history;
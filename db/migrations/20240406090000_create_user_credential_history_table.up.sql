@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_credential_history (
+  id SERIAL PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  credential_type VARCHAR(16) NOT NULL,
+  credential_value VARCHAR(64) NOT NULL,
+  verified_at TIMESTAMP,
+  replaced_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_credential_history_user_id ON user_credential_history(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_credential_history_credential_value ON user_credential_history(credential_value);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+  key VARCHAR(128) PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMP NOT NULL,
+  locked_until TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure_at ON login_attempts(last_failure_at);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+  user_id VARCHAR(48) PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  confirmed_at TIMESTAMP,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP(0) DEFAULT NOW(),
+  updated_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMP,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_uploads (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  object_key VARCHAR(128) NOT NULL,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_uploads_user_id ON user_uploads(user_id);
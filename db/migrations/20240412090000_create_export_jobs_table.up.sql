@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  object_key VARCHAR(128),
+  error_message TEXT,
+  started_at TIMESTAMP,
+  completed_at TIMESTAMP,
+  expires_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs(user_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_status_created_at ON export_jobs(status, created_at);
@@ -0,0 +1,6 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS bio VARCHAR(160),
+ADD COLUMN IF NOT EXISTS cover_image_url VARCHAR(256),
+ADD COLUMN IF NOT EXISTS location VARCHAR(64),
+ADD COLUMN IF NOT EXISTS website VARCHAR(256),
+ADD COLUMN IF NOT EXISTS birthday DATE;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS username VARCHAR(30);
+
+-- handles are unique regardless of case, "Bob" and "bob" are the same handle
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users(LOWER(username));
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS post_mentions (
+  id SERIAL PRIMARY KEY,
+  post_id VARCHAR(48) NOT NULL,
+  -- comment_id is empty for mentions in the post itself
+  comment_id VARCHAR(48),
+  user_id VARCHAR(48) NOT NULL,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_post_id ON post_mentions(post_id);
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions(user_id);
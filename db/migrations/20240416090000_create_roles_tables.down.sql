@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_role;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS role;
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
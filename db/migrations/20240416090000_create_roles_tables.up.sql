@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS roles (
+  name VARCHAR(16) PRIMARY KEY,
+  description VARCHAR(128) NOT NULL DEFAULT '',
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role VARCHAR(16) NOT NULL,
+  permission VARCHAR(64) NOT NULL,
+  PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+  ('user', 'Regular member'),
+  ('moderator', 'Moderates posts, comments and members'),
+  ('admin', 'Full administrative access')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('moderator', 'posts:moderate'),
+  ('moderator', 'users:moderate'),
+  ('admin', 'posts:moderate'),
+  ('admin', 'users:moderate'),
+  ('admin', 'users:ban'),
+  ('admin', 'roles:assign'),
+  ('admin', 'audit:read')
+ON CONFLICT (role, permission) DO NOTHING;
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user';
+
+-- only staff accounts are ever looked up by role
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role) WHERE role <> 'user';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS user_moderation_actions;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS banned_at,
+DROP COLUMN IF EXISTS suspended_until;
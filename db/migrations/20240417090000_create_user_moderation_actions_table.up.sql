@@ -0,0 +1,17 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMP,
+ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS user_moderation_actions (
+  id SERIAL PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  -- actor_id is the moderator or admin who took the action
+  actor_id VARCHAR(48) NOT NULL,
+  action VARCHAR(16) NOT NULL,
+  reason VARCHAR(500) NOT NULL DEFAULT '',
+  -- expires_at is only set for suspensions
+  expires_at TIMESTAMP(0),
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_moderation_actions_user_id ON user_moderation_actions(user_id);
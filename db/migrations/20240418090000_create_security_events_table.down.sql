@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS security_events_no_update ON security_events;
+DROP FUNCTION IF EXISTS reject_security_events_update();
+DROP TABLE IF EXISTS security_events;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS security_events (
+  id BIGSERIAL PRIMARY KEY,
+  -- user_id is empty for failed logins with an unknown credential
+  user_id VARCHAR(48),
+  event_type VARCHAR(32) NOT NULL,
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent VARCHAR(512) NOT NULL DEFAULT '',
+  details JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_id_created_at ON security_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_security_events_created_at ON security_events(created_at DESC);
+
+-- the log is append-only. Rows are only ever deleted, together with the rest of a purged account
+CREATE OR REPLACE FUNCTION reject_security_events_update() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'security_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS security_events_no_update ON security_events;
+CREATE TRIGGER security_events_no_update
+BEFORE UPDATE ON security_events
+FOR EACH ROW EXECUTE FUNCTION reject_security_events_update();
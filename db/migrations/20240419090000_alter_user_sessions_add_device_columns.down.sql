@@ -0,0 +1,4 @@
+ALTER TABLE user_sessions
+DROP COLUMN IF EXISTS last_seen_at,
+DROP COLUMN IF EXISTS ip,
+DROP COLUMN IF EXISTS user_agent;
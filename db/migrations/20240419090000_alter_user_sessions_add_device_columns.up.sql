@@ -0,0 +1,4 @@
+ALTER TABLE user_sessions
+ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS ip VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
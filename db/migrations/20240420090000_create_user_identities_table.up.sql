@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  provider VARCHAR(32) NOT NULL,
+  -- subject is the "sub" claim, the only stable identifier of the user at the provider
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(64),
+  created_at TIMESTAMP(0) DEFAULT NOW(),
+  last_login_at TIMESTAMP(0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities(provider, subject);
+-- one account per provider, so a login through the provider always lands on the same user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_user_id_provider ON user_identities(user_id, provider);
+
+-- oidc_login_states remember a started authorization until the provider redirects back
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+  state VARCHAR(64) PRIMARY KEY,
+  provider VARCHAR(32) NOT NULL,
+  nonce VARCHAR(64) NOT NULL,
+  code_verifier VARCHAR(128) NOT NULL,
+  -- user_id is set when a logged in user links the provider to their account
+  user_id VARCHAR(48),
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  id VARCHAR(48) PRIMARY KEY,
+  user_id VARCHAR(48) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  -- only the SHA-256 of the token is stored, token_prefix is kept to recognize it in listings
+  token_hash VARCHAR(64) NOT NULL,
+  token_prefix VARCHAR(16) NOT NULL,
+  scopes TEXT[] NOT NULL DEFAULT '{}',
+  expires_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP(0) DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
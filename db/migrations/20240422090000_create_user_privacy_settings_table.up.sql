@@ -0,0 +1,8 @@
+-- users without a row have the defaults, the row is only written once they change a setting
+CREATE TABLE IF NOT EXISTS user_privacy_settings (
+  user_id VARCHAR(48) PRIMARY KEY,
+  discoverable BOOLEAN NOT NULL DEFAULT TRUE,
+  friend_list_visibility VARCHAR(16) NOT NULL DEFAULT 'everyone',
+  comment_permission VARCHAR(16) NOT NULL DEFAULT 'friends',
+  updated_at TIMESTAMP(0) DEFAULT NOW()
+);
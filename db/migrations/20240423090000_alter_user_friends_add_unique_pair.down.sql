@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_friends_user_id_2_status;
+DROP INDEX IF EXISTS idx_user_friends_user_id_1_user_id_2;
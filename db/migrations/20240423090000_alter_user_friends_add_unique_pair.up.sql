@@ -0,0 +1,19 @@
+-- a pair of users has at most one row per direction: the request, and once accepted, the friendship.
+-- keep the oldest row of pairs added twice by concurrent requests
+DELETE FROM user_friends uf
+USING user_friends older
+WHERE
+  uf.user_id_1 = older.user_id_1
+  AND uf.user_id_2 = older.user_id_2
+  AND uf.id > older.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_friends_user_id_1_user_id_2 ON user_friends(user_id_1, user_id_2);
+CREATE INDEX IF NOT EXISTS idx_user_friends_user_id_2_status ON user_friends(user_id_2, status);
+
+-- the duplicates were counted when they were added, so recount from the friendships left
+UPDATE users u
+SET friend_count = (
+  SELECT COUNT(*)
+  FROM user_friends uf
+  WHERE uf.user_id_1 = u.id AND uf.status = 'confirmed'
+);
@@ -0,0 +1,2 @@
+-- fails while encrypted secrets are stored, as they do not fit in 64 characters
+ALTER TABLE user_totp ALTER COLUMN secret TYPE VARCHAR(64);
@@ -0,0 +1,2 @@
+-- secrets are stored encrypted, which takes more room than the base32 secret
+ALTER TABLE user_totp ALTER COLUMN secret TYPE VARCHAR(256);
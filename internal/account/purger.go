@@ -0,0 +1,149 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/session"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/s3"
+	"github.com/pkg/errors"
+)
+
+// Purger permanently removes the accounts whose deletion grace period is over
+type Purger struct {
+	accountRepo *AccountRepo
+	sessionRepo *session.SessionRepo
+	txProvider  *config.TransactionProvider
+	s3Provider  *s3.S3Provider
+	interval    time.Duration
+	batchSize   int
+}
+
+type PurgerConfig struct {
+	AccountRepo *AccountRepo
+	SessionRepo *session.SessionRepo
+	TxProvider  *config.TransactionProvider
+	S3Provider  *s3.S3Provider
+	Interval    time.Duration
+	BatchSize   int
+}
+
+func NewPurger(cfg PurgerConfig) *Purger {
+	return &Purger{
+		accountRepo: cfg.AccountRepo,
+		sessionRepo: cfg.SessionRepo,
+		txProvider:  cfg.TxProvider,
+		s3Provider:  cfg.S3Provider,
+		interval:    cfg.Interval,
+		batchSize:   cfg.BatchSize,
+	}
+}
+
+// Run purges due accounts every interval until ctx is cancelled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := p.PurgeDue(ctx)
+			if err != nil {
+				log.Printf("account purge failed: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("purged %d deleted accounts", purged)
+			}
+		}
+	}
+}
+
+// PurgeDue purges up to one batch of accounts and returns how many were removed
+func (p *Purger) PurgeDue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	userIDs, err := p.accountRepo.ListDueDeletions(ctx, now, p.batchSize)
+	if err != nil {
+		return 0, errors.Wrap(err, "ListDueDeletions error")
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		ok, err := p.purgeUser(ctx, userID, now)
+		if err != nil {
+			return purged, errors.Wrapf(err, "purge user %s error", userID)
+		}
+		if ok {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (p *Purger) purgeUser(ctx context.Context, userID string, now time.Time) (bool, error) {
+	tx, err := p.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = p.accountRepo.LockDueUser(ctx, tx, userID, now)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// cancelled by a login, or purged by another instance
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, "LockDueUser error")
+	}
+
+	// only the objects the user's own rows point at. The image URL of the profile is not one of them,
+	// it can be set to any object of the bucket, including someone else's upload
+	objectKeys, err := p.accountRepo.ListObjectKeys(ctx, tx, userID)
+	if err != nil {
+		return false, errors.Wrap(err, "ListObjectKeys error")
+	}
+
+	// friend counts must be lowered before the friendships they count are deleted
+	err = p.accountRepo.DecrementFriendsFriendCount(ctx, tx, userID)
+	if err != nil {
+		return false, errors.Wrap(err, "DecrementFriendsFriendCount error")
+	}
+
+	err = p.accountRepo.DeleteUserData(ctx, tx, userID)
+	if err != nil {
+		return false, errors.Wrap(err, "DeleteUserData error")
+	}
+
+	// access tokens issued before now must not outlive the account
+	err = p.sessionRepo.SetUserTokensRevokedBefore(ctx, tx, userID, now)
+	if err != nil {
+		return false, errors.Wrap(err, "SetUserTokensRevokedBefore error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, errors.Wrap(err, "Commit error")
+	}
+
+	// the rows are gone at this point, a failed delete only leaves an unreferenced object behind
+	deleted := map[string]bool{}
+	for _, key := range objectKeys {
+		if deleted[key] {
+			continue
+		}
+		deleted[key] = true
+
+		if err := p.s3Provider.DeleteObject(ctx, key); err != nil {
+			log.Printf("failed to delete object %s of purged user %s: %v", key, userID, err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,166 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type AccountRepo struct {
+	db *sqlx.DB
+}
+
+func NewAccountRepo(db *sqlx.DB) AccountRepo {
+	return AccountRepo{db: db}
+}
+
+// ListDueDeletions returns the IDs of accounts whose grace period ended before now
+func (r *AccountRepo) ListDueDeletions(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	var result []string
+
+	query := `
+		SELECT
+			id
+		FROM
+			users
+		WHERE
+			deletion_scheduled_at <= $1
+		ORDER BY
+			deletion_scheduled_at ASC
+		LIMIT $2
+	`
+
+	err := r.db.SelectContext(ctx, &result, query, now, limit)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// LockDueUser locks the user row for the purge. It returns sql.ErrNoRows when the deletion was
+// cancelled in the meantime, or when another instance is already purging the user
+func (r *AccountRepo) LockDueUser(ctx context.Context, tx *sql.Tx, userID string, now time.Time) error {
+	var id string
+
+	query := `
+		SELECT
+			id
+		FROM
+			users
+		WHERE
+			id = $1
+			AND deletion_scheduled_at <= $2
+		FOR UPDATE SKIP LOCKED
+	`
+
+	err := tx.QueryRowContext(ctx, query, userID, now).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListObjectKeys returns the keys of every S3 object owned by the user: uploads and export archives
+func (r *AccountRepo) ListObjectKeys(ctx context.Context, tx *sql.Tx, userID string) ([]string, error) {
+	query := `
+		SELECT
+			object_key
+		FROM
+			user_uploads
+		WHERE
+			user_id = $1
+		UNION
+		SELECT
+			object_key
+		FROM
+			export_jobs
+		WHERE
+			user_id = $1
+			AND object_key IS NOT NULL
+			AND status = 'completed'
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DecrementFriendsFriendCount lowers the friend count of everyone who has the user as a friend
+func (r *AccountRepo) DecrementFriendsFriendCount(ctx context.Context, tx *sql.Tx, userID string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			friend_count = friend_count - 1
+		WHERE
+			id IN (
+				SELECT user_id_2 FROM user_friends WHERE user_id_1 = $1 AND status = 'confirmed'
+			)
+	`
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// purgeQueries remove every row referencing the user. There are no foreign keys in the schema,
+// so children go first: rows found through the user's posts and sessions before the posts and sessions.
+// user_moderation_actions is kept on purpose, deleting the account must not erase a ban or its reason
+var purgeQueries = []string{
+	`DELETE FROM user_friends WHERE user_id_1 = $1 OR user_id_2 = $1`,
+	`DELETE FROM post_tags WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+	`DELETE FROM post_mentions
+		WHERE user_id = $1
+		OR post_id IN (SELECT id FROM posts WHERE user_id = $1)
+		OR comment_id IN (SELECT id FROM post_comments WHERE user_id = $1)`,
+	`DELETE FROM post_comments WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+	`DELETE FROM posts WHERE user_id = $1`,
+	`DELETE FROM user_refresh_tokens WHERE session_id IN (SELECT id FROM user_sessions WHERE user_id = $1)`,
+	`DELETE FROM user_sessions WHERE user_id = $1`,
+	`DELETE FROM revoked_access_tokens WHERE user_id = $1`,
+	`DELETE FROM verification_codes WHERE user_id = $1`,
+	`DELETE FROM user_credential_history WHERE user_id = $1`,
+	`DELETE FROM user_totp WHERE user_id = $1`,
+	`DELETE FROM user_recovery_codes WHERE user_id = $1`,
+	`DELETE FROM user_uploads WHERE user_id = $1`,
+	`DELETE FROM export_jobs WHERE user_id = $1`,
+	`DELETE FROM security_events WHERE user_id = $1`,
+	`DELETE FROM user_identities WHERE user_id = $1`,
+	`DELETE FROM oidc_login_states WHERE user_id = $1`,
+	`DELETE FROM personal_access_tokens WHERE user_id = $1`,
+	`DELETE FROM user_privacy_settings WHERE user_id = $1`,
+	`DELETE FROM users WHERE id = $1`,
+}
+
+func (r *AccountRepo) DeleteUserData(ctx context.Context, tx *sql.Tx, userID string) error {
+	for _, query := range purgeQueries {
+		_, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return errors.Wrapf(err, "purge query %q error", query)
+		}
+	}
+
+	return nil
+}
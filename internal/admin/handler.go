@@ -0,0 +1,378 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/session"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/middleware"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+type adminHandler struct {
+	userRepo       *user.UserRepo
+	moderationRepo *ModerationRepo
+	roleRepo       *role.RoleRepo
+	txProvider     *config.TransactionProvider
+	revoker        *session.Revoker
+	auditRecorder  *audit.Recorder
+}
+
+type AdminHandlerConfig struct {
+	UserRepo       *user.UserRepo
+	ModerationRepo *ModerationRepo
+	RoleRepo       *role.RoleRepo
+	TxProvider     *config.TransactionProvider
+	Revoker        *session.Revoker
+	AuditRecorder  *audit.Recorder
+}
+
+func NewAdminHandler(cfg AdminHandlerConfig) adminHandler {
+	return adminHandler{
+		userRepo:       cfg.UserRepo,
+		moderationRepo: cfg.ModerationRepo,
+		roleRepo:       cfg.RoleRepo,
+		txProvider:     cfg.TxProvider,
+		revoker:        cfg.Revoker,
+		auditRecorder:  cfg.AuditRecorder,
+	}
+}
+
+func (h *adminHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
+	group := r.Group("/v1/admin/users/:userId<guid>")
+	authMiddleware := jwtProvider.Middleware()
+	canModerate := middleware.RequirePermission(role.PermissionModerateUsers)
+	canBan := middleware.RequirePermission(role.PermissionBanUsers)
+	canAssignRoles := middleware.RequirePermission(role.PermissionAssignRoles)
+
+	group.Get("/moderation", authMiddleware, canModerate, h.GetModerationHistory)
+	group.Post("/suspend", authMiddleware, canModerate, h.SuspendUser)
+	group.Delete("/suspend", authMiddleware, canModerate, h.UnsuspendUser)
+	group.Post("/ban", authMiddleware, canBan, h.BanUser)
+	group.Delete("/ban", authMiddleware, canBan, h.UnbanUser)
+	group.Put("/role", authMiddleware, canAssignRoles, h.AssignRole)
+}
+
+func (h *adminHandler) SuspendUser(c *fiber.Ctx) error {
+	var payload SuspendUserRequest
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.ActorID = claims.UserID
+	payload.TargetUserID = c.Params("userId")
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	target, err := h.suspendUser(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, target.ID, audit.Details{
+		"reason":  "suspended",
+		"actorId": payload.ActorID,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "user suspended",
+		Data:    newModerationStatusResponse(target),
+	})
+}
+
+func (h *adminHandler) suspendUser(ctx context.Context, payload SuspendUserRequest) (user.User, error) {
+	now := time.Now().UTC()
+	suspendedUntil := sql.NullTime{
+		Time:  now.Add(time.Duration(payload.DurationHours) * time.Hour),
+		Valid: true,
+	}
+
+	return h.applyAction(ctx, ModerationAction{
+		UserID:    payload.TargetUserID,
+		ActorID:   payload.ActorID,
+		Action:    ActionSuspend,
+		Reason:    payload.Reason,
+		ExpiresAt: suspendedUntil,
+		CreatedAt: now,
+	}, func(target *user.User) error {
+		if target.IsBanned() {
+			return config.ErrUserAlreadyBanned
+		}
+
+		target.SuspendedUntil = suspendedUntil
+		return nil
+	})
+}
+
+func (h *adminHandler) UnsuspendUser(c *fiber.Ctx) error {
+	payload, err := parseLiftRequest(c)
+	if err != nil {
+		return err
+	}
+
+	target, err := h.unsuspendUser(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "user suspension lifted",
+		Data:    newModerationStatusResponse(target),
+	})
+}
+
+func (h *adminHandler) unsuspendUser(ctx context.Context, payload LiftRequest) (user.User, error) {
+	now := time.Now().UTC()
+
+	return h.applyAction(ctx, ModerationAction{
+		UserID:    payload.TargetUserID,
+		ActorID:   payload.ActorID,
+		Action:    ActionUnsuspend,
+		Reason:    payload.Reason,
+		CreatedAt: now,
+	}, func(target *user.User) error {
+		if !target.IsSuspended(now) {
+			return config.ErrUserNotSuspended
+		}
+
+		target.SuspendedUntil = sql.NullTime{}
+		return nil
+	})
+}
+
+func (h *adminHandler) BanUser(c *fiber.Ctx) error {
+	var payload BanUserRequest
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.ActorID = claims.UserID
+	payload.TargetUserID = c.Params("userId")
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	target, err := h.banUser(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, target.ID, audit.Details{
+		"reason":  "banned",
+		"actorId": payload.ActorID,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "user banned",
+		Data:    newModerationStatusResponse(target),
+	})
+}
+
+func (h *adminHandler) banUser(ctx context.Context, payload BanUserRequest) (user.User, error) {
+	now := time.Now().UTC()
+
+	return h.applyAction(ctx, ModerationAction{
+		UserID:    payload.TargetUserID,
+		ActorID:   payload.ActorID,
+		Action:    ActionBan,
+		Reason:    payload.Reason,
+		CreatedAt: now,
+	}, func(target *user.User) error {
+		if target.IsBanned() {
+			return config.ErrUserAlreadyBanned
+		}
+
+		target.BannedAt = sql.NullTime{Time: now, Valid: true}
+		return nil
+	})
+}
+
+func (h *adminHandler) UnbanUser(c *fiber.Ctx) error {
+	payload, err := parseLiftRequest(c)
+	if err != nil {
+		return err
+	}
+
+	target, err := h.unbanUser(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "user ban lifted",
+		Data:    newModerationStatusResponse(target),
+	})
+}
+
+func (h *adminHandler) unbanUser(ctx context.Context, payload LiftRequest) (user.User, error) {
+	return h.applyAction(ctx, ModerationAction{
+		UserID:    payload.TargetUserID,
+		ActorID:   payload.ActorID,
+		Action:    ActionUnban,
+		Reason:    payload.Reason,
+		CreatedAt: time.Now().UTC(),
+	}, func(target *user.User) error {
+		if !target.IsBanned() {
+			return config.ErrUserNotBanned
+		}
+
+		target.BannedAt = sql.NullTime{}
+		return nil
+	})
+}
+
+func (h *adminHandler) GetModerationHistory(c *fiber.Ctx) error {
+	ctx := c.Context()
+	target, err := h.userRepo.GetUserByID(ctx, c.Params("userId"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrUserNotFound
+		}
+
+		return errors.Wrap(err, "GetUserByID error")
+	}
+
+	actions, err := h.moderationRepo.ListActions(ctx, target.ID)
+	if err != nil {
+		return errors.Wrap(err, "ListActions error")
+	}
+
+	responses := []ModerationActionResponse{}
+	for _, action := range actions {
+		response := ModerationActionResponse{
+			ActorID:   action.ActorID,
+			Action:    action.Action,
+			Reason:    action.Reason,
+			CreatedAt: action.CreatedAt,
+		}
+		if action.ExpiresAt.Valid {
+			response.ExpiresAt = &action.ExpiresAt.Time
+		}
+
+		responses = append(responses, response)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    responses,
+	})
+}
+
+// applyAction runs a moderation action on its target along with recording it. The target is locked and
+// read inside the transaction, so change checks and updates the current state even when several actions
+// on the same user run at once. Only the column of the action is written back.
+// Staff accounts have to be demoted through the role API before they can be suspended or banned.
+// Suspensions and bans also end every session of the target
+func (h *adminHandler) applyAction(ctx context.Context, action ModerationAction, change func(target *user.User) error) (user.User, error) {
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return user.User{}, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	target, err := h.moderationRepo.LockModerationState(ctx, tx, action.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return target, config.ErrUserNotFound
+		}
+
+		return target, errors.Wrap(err, "LockModerationState error")
+	}
+
+	if target.Role != role.RoleUser {
+		return target, config.ErrCannotModerateStaff
+	}
+
+	if err := change(&target); err != nil {
+		return target, err
+	}
+
+	switch action.Action {
+	case ActionSuspend, ActionUnsuspend:
+		err = h.moderationRepo.SetSuspendedUntil(ctx, tx, target.ID, target.SuspendedUntil)
+		if err != nil {
+			return target, errors.Wrap(err, "SetSuspendedUntil error")
+		}
+	case ActionBan, ActionUnban:
+		err = h.moderationRepo.SetBannedAt(ctx, tx, target.ID, target.BannedAt)
+		if err != nil {
+			return target, errors.Wrap(err, "SetBannedAt error")
+		}
+	}
+
+	err = h.moderationRepo.CreateAction(ctx, tx, action)
+	if err != nil {
+		return target, errors.Wrap(err, "CreateAction error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return target, errors.Wrap(err, "commit error")
+	}
+
+	if action.Action == ActionSuspend || action.Action == ActionBan {
+		err = h.revoker.RevokeUser(ctx, target.ID)
+		if err != nil {
+			return target, errors.Wrap(err, "RevokeUser error")
+		}
+	}
+
+	return target, nil
+}
+
+func parseLiftRequest(c *fiber.Ctx) (LiftRequest, error) {
+	var payload LiftRequest
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return payload, config.ErrRequestForbidden
+	}
+	payload.ActorID = claims.UserID
+	payload.TargetUserID = c.Params("userId")
+
+	// the reason is optional, so is the body
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return payload, errors.Wrap(config.ErrMalformedRequest, err.Error())
+		}
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return payload, err
+	}
+
+	return payload, nil
+}
+
+func newModerationStatusResponse(u user.User) ModerationStatusResponse {
+	response := ModerationStatusResponse{UserID: u.ID}
+	if u.SuspendedUntil.Valid {
+		response.SuspendedUntil = &u.SuspendedUntil.Time
+	}
+	if u.BannedAt.Valid {
+		response.BannedAt = &u.BannedAt.Time
+	}
+
+	return response
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"database/sql"
+	"time"
+)
+
+// moderation actions recorded in user_moderation_actions
+const (
+	ActionSuspend   = "suspend"
+	ActionUnsuspend = "unsuspend"
+	ActionBan       = "ban"
+	ActionUnban     = "unban"
+)
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason" validate:"required,min=5,max=500"`
+	// DurationHours is how long the suspension lasts, up to a year
+	DurationHours int `json:"durationHours" validate:"required,min=1,max=8760"`
+
+	TargetUserID string
+	ActorID      string
+}
+
+type BanUserRequest struct {
+	Reason string `json:"reason" validate:"required,min=5,max=500"`
+
+	TargetUserID string
+	ActorID      string
+}
+
+type LiftRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+
+	TargetUserID string
+	ActorID      string
+}
+
+type ModerationAction struct {
+	ID        int          `db:"id"`
+	UserID    string       `db:"user_id"`
+	ActorID   string       `db:"actor_id"`
+	Action    string       `db:"action"`
+	Reason    string       `db:"reason"`
+	ExpiresAt sql.NullTime `db:"expires_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
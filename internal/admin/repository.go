@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/jmoiron/sqlx"
+)
+
+type ModerationRepo struct {
+	db *sqlx.DB
+}
+
+func NewModerationRepo(db *sqlx.DB) ModerationRepo {
+	return ModerationRepo{db: db}
+}
+
+// LockModerationState locks the user row for the rest of tx and returns its role and moderation state
+func (r *ModerationRepo) LockModerationState(ctx context.Context, tx *sql.Tx, userID string) (user.User, error) {
+	var result user.User
+
+	query := `
+		SELECT
+			id,
+			role,
+			suspended_until,
+			banned_at
+		FROM
+			users
+		WHERE
+			id = $1
+		FOR UPDATE
+	`
+
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&result.ID, &result.Role, &result.SuspendedUntil, &result.BannedAt)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// SetSuspendedUntil suspends the user until the given time. A null time lifts the suspension
+func (r *ModerationRepo) SetSuspendedUntil(ctx context.Context, tx *sql.Tx, userID string, until sql.NullTime) error {
+	query := `
+		UPDATE
+			users
+		SET
+			suspended_until = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, until)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, until)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetBannedAt bans the user from the given time. A null time lifts the ban
+func (r *ModerationRepo) SetBannedAt(ctx context.Context, tx *sql.Tx, userID string, at sql.NullTime) error {
+	query := `
+		UPDATE
+			users
+		SET
+			banned_at = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, at)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, at)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *ModerationRepo) CreateAction(ctx context.Context, tx *sql.Tx, action ModerationAction) error {
+	query := `
+		INSERT INTO
+			user_moderation_actions
+			(user_id, actor_id, action, reason, expires_at, created_at)
+		VALUES
+			(:user_id, :actor_id, :action, :reason, :expires_at, :created_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, action)
+	if err != nil {
+		return err
+	}
+
+	// since we won't be using the returned data, leave it blank
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListActions returns the moderation history of the user, newest first
+func (r *ModerationRepo) ListActions(ctx context.Context, userID string) ([]ModerationAction, error) {
+	actions := []ModerationAction{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			actor_id,
+			action,
+			reason,
+			expires_at,
+			created_at
+		FROM
+			user_moderation_actions
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at DESC,
+			id DESC
+	`
+
+	err := r.db.SelectContext(ctx, &actions, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
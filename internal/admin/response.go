@@ -0,0 +1,17 @@
+package admin
+
+import "time"
+
+type ModerationStatusResponse struct {
+	UserID         string     `json:"userId"`
+	SuspendedUntil *time.Time `json:"suspendedUntil"`
+	BannedAt       *time.Time `json:"bannedAt"`
+}
+
+type ModerationActionResponse struct {
+	ActorID   string     `json:"actorId"`
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
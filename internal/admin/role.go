@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// AssignRole changes the role of a user. It is served with the other admin endpoints on users rather than
+// from the role package, which the audit package depends on and so cannot record security events
+func (h *adminHandler) AssignRole(c *fiber.Ctx) error {
+	var payload role.AssignRoleRequest
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+	payload.TargetUserID = c.Params("userId")
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	err = h.assignRole(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, payload.TargetUserID, audit.Details{
+		"reason":  "role_changed",
+		"actorId": payload.UserID,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "role assigned",
+	})
+}
+
+func (h *adminHandler) assignRole(ctx context.Context, payload role.AssignRoleRequest) error {
+	// otherwise the last admin could lock everyone out of the admin endpoints
+	if payload.TargetUserID == payload.UserID {
+		return config.ErrCannotChangeOwnRole
+	}
+
+	err := h.roleRepo.SetUserRole(ctx, nil, payload.TargetUserID, payload.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrUserNotFound
+		}
+
+		return errors.Wrap(err, "SetUserRole error")
+	}
+
+	// permissions live in the access tokens, so the current ones must be replaced by refreshed ones
+	err = h.revoker.RevokeUserAccessTokens(ctx, payload.TargetUserID)
+	if err != nil {
+		return errors.Wrap(err, "RevokeUserAccessTokens error")
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+type auditHandler struct {
+	auditRepo *AuditRepo
+}
+
+type AuditHandlerConfig struct {
+	AuditRepo *AuditRepo
+}
+
+func NewAuditHandler(cfg AuditHandlerConfig) auditHandler {
+	return auditHandler{
+		auditRepo: cfg.AuditRepo,
+	}
+}
+
+func (h *auditHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
+	authMiddleware := jwtProvider.Middleware()
+
+	r.Get("/v1/user/security-events", authMiddleware, h.ListMyEvents)
+	r.Get("/v1/admin/security-events", authMiddleware, middleware.RequirePermission(role.PermissionReadAudit), h.ListEvents)
+}
+
+func (h *auditHandler) ListMyEvents(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	payload, err := parseListEventsRequest(c)
+	if err != nil {
+		return err
+	}
+	// users only see their own events, and only filter them by type and time
+	payload.UserID = claims.UserID
+	payload.IP = ""
+
+	responses, meta, err := h.listEvents(c.Context(), payload, false)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    responses,
+		Meta:    &meta,
+	})
+}
+
+func (h *auditHandler) ListEvents(c *fiber.Ctx) error {
+	payload, err := parseListEventsRequest(c)
+	if err != nil {
+		return err
+	}
+
+	responses, meta, err := h.listEvents(c.Context(), payload, true)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    responses,
+		Meta:    &meta,
+	})
+}
+
+func (h *auditHandler) listEvents(ctx context.Context, payload ListEventsRequest, withUserID bool) ([]SecurityEventResponse, model.ResponseMeta, error) {
+	var responseMeta model.ResponseMeta
+
+	events, count, err := h.auditRepo.ListEvents(ctx, payload)
+	if err != nil {
+		return nil, responseMeta, errors.Wrap(err, "ListEvents error")
+	}
+
+	responses := []SecurityEventResponse{}
+	for _, event := range events {
+		response := newSecurityEventResponse(event)
+		if withUserID {
+			response.UserID = event.UserID.String
+		}
+
+		responses = append(responses, response)
+	}
+
+	responseMeta.Limit = payload.Limit
+	responseMeta.Offset = payload.Offset
+	responseMeta.Total = uint(count)
+
+	return responses, responseMeta, nil
+}
+
+func parseListEventsRequest(c *fiber.Ctx) (ListEventsRequest, error) {
+	var payload ListEventsRequest
+	if err := c.QueryParser(&payload); err != nil {
+		return payload, errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	payload.Queries = c.Queries()
+	if err := payload.Validate(); err != nil {
+		return payload, err
+	}
+
+	return payload, nil
+}
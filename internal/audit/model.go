@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+)
+
+// event types recorded in security_events
+const (
+	EventRegister          = "register"
+	EventLoginSucceeded    = "login_succeeded"
+	EventLoginFailed       = "login_failed"
+	EventCredentialLinked  = "credential_linked"
+	EventCredentialChanged = "credential_changed"
+	EventProfileUpdated    = "profile_updated"
+	EventPrivacyUpdated    = "privacy_updated"
+	EventPasswordChanged   = "password_changed"
+	EventPasswordReset     = "password_reset"
+	EventTokensRevoked     = "tokens_revoked"
+	EventIdentityLinked    = "identity_linked"
+	EventIdentityUnlinked  = "identity_unlinked"
+	// personal access tokens
+	EventPersonalTokenCreated = "personal_token_created"
+	EventPersonalTokenRevoked = "personal_token_revoked"
+)
+
+var allowedEventTypes = map[string]bool{
+	EventRegister:             true,
+	EventLoginSucceeded:       true,
+	EventLoginFailed:          true,
+	EventCredentialLinked:     true,
+	EventCredentialChanged:    true,
+	EventProfileUpdated:       true,
+	EventPrivacyUpdated:       true,
+	EventPasswordChanged:      true,
+	EventPasswordReset:        true,
+	EventTokensRevoked:        true,
+	EventIdentityLinked:       true,
+	EventIdentityUnlinked:     true,
+	EventPersonalTokenCreated: true,
+	EventPersonalTokenRevoked: true,
+}
+
+type Event struct {
+	ID        int64          `db:"id"`
+	UserID    sql.NullString `db:"user_id"`
+	Type      string         `db:"event_type"`
+	IP        string         `db:"ip"`
+	UserAgent string         `db:"user_agent"`
+	// Details is a JSON object with event specific fields, such as the reason of a failed login
+	Details   []byte    `db:"details"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Details are the event specific fields. Never put secrets or credentials in there
+type Details map[string]string
+
+type ListEventsRequest struct {
+	Limit  uint   `query:"limit"`
+	Offset uint   `query:"offset"`
+	Type   string `query:"type"`
+	// the filters below are only accepted from admins
+	UserID string `query:"userId"`
+	IP     string `query:"ip"`
+	From   string `query:"from"`
+	To     string `query:"to"`
+
+	FromTime time.Time
+	ToTime   time.Time
+	Queries  map[string]string
+}
+
+func (r *ListEventsRequest) Validate() error {
+	var validationErrs validation.Errors
+	queries := r.Queries
+
+	if val, ok := queries["limit"]; ok && val == "" {
+		validationErrs.Add("limit", "required", "is empty")
+	}
+	if r.Limit > 100 {
+		validationErrs.Add("limit", "max", "must be at most 100")
+	}
+	if r.Limit == 0 {
+		r.Limit = 20
+	}
+
+	if val, ok := queries["offset"]; ok && val == "" {
+		validationErrs.Add("offset", "required", "is empty")
+	}
+
+	if _, found := allowedEventTypes[r.Type]; r.Type != "" && !found {
+		validationErrs.Add("type", "oneof", "is not a known event type")
+	}
+
+	if r.From != "" {
+		from, err := time.Parse(time.RFC3339, r.From)
+		if err != nil {
+			validationErrs.Add("from", "datetime", "is not an RFC 3339 time")
+		}
+		r.FromTime = from.UTC()
+	}
+
+	if r.To != "" {
+		to, err := time.Parse(time.RFC3339, r.To)
+		if err != nil {
+			validationErrs.Add("to", "datetime", "is not an RFC 3339 time")
+		}
+		r.ToTime = to.UTC()
+	}
+
+	return validationErrs.Err()
+}
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxUserAgentLength is the size of the user_agent column
+const maxUserAgentLength = 512
+
+// RequestInfo is where a request came from
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func RequestInfoFrom(c *fiber.Ctx) RequestInfo {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	return RequestInfo{
+		IP:        c.IP(),
+		UserAgent: userAgent,
+	}
+}
+
+type Recorder struct {
+	auditRepo *AuditRepo
+}
+
+func NewRecorder(auditRepo *AuditRepo) *Recorder {
+	return &Recorder{auditRepo: auditRepo}
+}
+
+// Record appends an event to the security log. userID may be empty when the user is unknown.
+// Failures are logged instead of returned, the action being recorded already happened
+func (r *Recorder) Record(ctx context.Context, info RequestInfo, eventType, userID string, details Details) {
+	if details == nil {
+		details = Details{}
+	}
+
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		log.Printf("failed to encode %s security event details: %v", eventType, err)
+		return
+	}
+
+	err = r.auditRepo.CreateEvent(ctx, nil, Event{
+		UserID:    sql.NullString{String: userID, Valid: userID != ""},
+		Type:      eventType,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		Details:   encoded,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("failed to record %s security event: %v", eventType, err)
+	}
+}
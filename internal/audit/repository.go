@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepo(db *sqlx.DB) AuditRepo {
+	return AuditRepo{db: db}
+}
+
+func (r *AuditRepo) CreateEvent(ctx context.Context, tx *sql.Tx, event Event) error {
+	query := `
+		INSERT INTO
+			security_events
+			(user_id, event_type, ip, user_agent, details, created_at)
+		VALUES
+			(:user_id, :event_type, :ip, :user_agent, :details, :created_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, event)
+	if err != nil {
+		return err
+	}
+
+	// since we won't be using the returned data, leave it blank
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListEvents returns the events matching the request, newest first, along with their total count
+func (r *AuditRepo) ListEvents(ctx context.Context, req ListEventsRequest) ([]Event, int, error) {
+	events := []Event{}
+
+	baseQuery := `
+		SELECT
+			id,
+			user_id,
+			event_type,
+			ip,
+			user_agent,
+			details,
+			created_at
+		FROM
+			security_events
+		WHERE
+			TRUE
+		%s
+	`
+
+	filterQuery, args := getFilter(req)
+	queryWithFilter := fmt.Sprintf(baseQuery, filterQuery)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS temp", queryWithFilter)
+
+	var count int
+	err := r.db.GetContext(ctx, &count, sqlx.Rebind(sqlx.DOLLAR, countQuery), args...)
+	if err != nil {
+		return events, count, err
+	}
+
+	args = append(args, req.Limit, req.Offset)
+
+	query := fmt.Sprintf("%s ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", queryWithFilter)
+
+	err = r.db.SelectContext(ctx, &events, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return events, count, err
+	}
+
+	return events, count, nil
+}
+
+func getFilter(req ListEventsRequest) (string, []interface{}) {
+	args := []interface{}{}
+	filter := ""
+
+	if req.UserID != "" {
+		filter += " AND user_id = ?"
+		args = append(args, req.UserID)
+	}
+
+	if req.Type != "" {
+		filter += " AND event_type = ?"
+		args = append(args, req.Type)
+	}
+
+	if req.IP != "" {
+		filter += " AND ip = ?"
+		args = append(args, req.IP)
+	}
+
+	if !req.FromTime.IsZero() {
+		filter += " AND created_at >= ?"
+		args = append(args, req.FromTime)
+	}
+
+	if !req.ToTime.IsZero() {
+		filter += " AND created_at < ?"
+		args = append(args, req.ToTime)
+	}
+
+	return filter, args
+}
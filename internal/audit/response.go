@@ -0,0 +1,32 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type SecurityEventResponse struct {
+	ID int64 `json:"id"`
+	// UserID is only shown to admins
+	UserID    string    `json:"userId,omitempty"`
+	Type      string    `json:"type"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Details   Details   `json:"details"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newSecurityEventResponse(event Event) SecurityEventResponse {
+	details := Details{}
+	// details are always written from a Details value, a broken row just shows none
+	_ = json.Unmarshal(event.Details, &details)
+
+	return SecurityEventResponse{
+		ID:        event.ID,
+		Type:      event.Type,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		Details:   details,
+		CreatedAt: event.CreatedAt,
+	}
+}
@@ -22,6 +22,57 @@ type S3Config struct {
 	Region    string `env:"S3_REGION"`
 }
 
+type NotifierConfig struct {
+	// EmailDriver is either "smtp" or "log"
+	EmailDriver string `env:"NOTIFIER_EMAIL_DRIVER,default=log"`
+	// SMSDriver is either "http" or "log"
+	SMSDriver string `env:"NOTIFIER_SMS_DRIVER,default=log"`
+	// LogFile makes the log drivers append to this file instead of the application log
+	LogFile string `env:"NOTIFIER_LOG_FILE"`
+
+	SMTPHost     string `env:"SMTP_HOST"`
+	SMTPPort     string `env:"SMTP_PORT,default=587"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	SMTPFrom     string `env:"SMTP_FROM"`
+
+	SMSGatewayURL   string `env:"SMS_GATEWAY_URL"`
+	SMSGatewayToken string `env:"SMS_GATEWAY_TOKEN"`
+	SMSSender       string `env:"SMS_SENDER"`
+}
+
+type LoginGuardConfig struct {
+	// Store is either "memory" (single instance) or "postgres" (shared between instances)
+	Store string `env:"LOGIN_GUARD_STORE,default=memory"`
+	// CredentialFreeAttempts and IPFreeAttempts are the failures tolerated before lockouts start
+	CredentialFreeAttempts int `env:"LOGIN_GUARD_CREDENTIAL_FREE_ATTEMPTS,default=5"`
+	IPFreeAttempts         int `env:"LOGIN_GUARD_IP_FREE_ATTEMPTS,default=20"`
+	// the lockout doubles on every further failure, from BaseLockoutSeconds up to MaxLockoutSeconds
+	BaseLockoutSeconds int `env:"LOGIN_GUARD_BASE_LOCKOUT_SECONDS,default=30"`
+	MaxLockoutSeconds  int `env:"LOGIN_GUARD_MAX_LOCKOUT_SECONDS,default=900"`
+	// WindowMinutes is how long a failure is remembered
+	WindowMinutes int `env:"LOGIN_GUARD_WINDOW_MINUTES,default=60"`
+}
+
+type PasswordHasherConfig struct {
+	// Algorithm new hashes are made with, either "argon2id" or "bcrypt". Hashes of the other one
+	// are still accepted and replaced on the next successful login
+	Algorithm string `env:"PASSWORD_HASHER,default=argon2id"`
+	// argon2id costs, the defaults are the OWASP recommendation
+	Argon2MemoryKiB   uint32 `env:"ARGON2_MEMORY_KIB,default=19456"`
+	Argon2Iterations  uint32 `env:"ARGON2_ITERATIONS,default=2"`
+	Argon2Parallelism uint8  `env:"ARGON2_PARALLELISM,default=1"`
+}
+
+type OIDCConfig struct {
+	// Providers is the comma separated names of the enabled OpenID Connect providers. Each one is set up
+	// through OIDC_<NAME>_ISSUER_URL, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET,
+	// OIDC_<NAME>_REDIRECT_URL and OIDC_<NAME>_SCOPES
+	Providers string `env:"OIDC_PROVIDERS"`
+	// LoginStateMinutes is how long the user has to sign in at the provider
+	LoginStateMinutes int `env:"OIDC_LOGIN_STATE_MINUTES,default=10"`
+}
+
 type Config struct {
 	Database          DatabaseConfig
 	AppPort           string `env:"APP_PORT,default=8080"`
@@ -29,14 +80,57 @@ type Config struct {
 	Env               string `env:"ENV"`
 
 	// security-related options
-	JWTSecret  string `env:"JWT_SECRET"`
-	BcryptSalt int    `env:"BCRYPT_SALT"`
+	JWTSecret string `env:"JWT_SECRET"`
+	// JWTKeysDir holds the RSA/Ed25519 signing keys as <kid>.pem files
+	JWTKeysDir string `env:"JWT_KEYS_DIR"`
+	// JWTActiveKeyID is the key ID new tokens are signed with. Empty means JWT_SECRET (HS256)
+	JWTActiveKeyID string `env:"JWT_ACTIVE_KEY_ID"`
+	JWTIssuer      string `env:"JWT_ISSUER"`
+	JWTAudience    string `env:"JWT_AUDIENCE"`
+	BcryptSalt     int    `env:"BCRYPT_SALT"`
+	// TOTPEncryptionKey is the base64 encoded 32 bytes key the TOTP secrets are encrypted with
+	TOTPEncryptionKey string `env:"TOTP_ENCRYPTION_KEY"`
+	// RefreshTokenExpiryHours is how long a refresh token stays usable after it is issued
+	RefreshTokenExpiryHours int `env:"REFRESH_TOKEN_EXPIRY_HOURS,default=720"`
+	// TokenRevocationCacheSeconds bounds how long an instance may keep accepting a token
+	// revoked through another instance
+	TokenRevocationCacheSeconds int `env:"TOKEN_REVOCATION_CACHE_SECONDS,default=30"`
+	// VerificationCodeExpiryMinutes is the lifetime of one-time codes sent by email or SMS
+	VerificationCodeExpiryMinutes int `env:"VERIFICATION_CODE_EXPIRY_MINUTES,default=15"`
+	// AccountDeletionGraceHours is how long a deleted account can still be restored by logging in
+	AccountDeletionGraceHours int `env:"ACCOUNT_DELETION_GRACE_HOURS,default=336"`
+	// AccountPurgeIntervalMinutes is how often deleted accounts past their grace period are purged
+	AccountPurgeIntervalMinutes int `env:"ACCOUNT_PURGE_INTERVAL_MINUTES,default=10"`
+	// ExportWorkerIntervalSeconds is how often the data export worker polls for new jobs
+	ExportWorkerIntervalSeconds int `env:"EXPORT_WORKER_INTERVAL_SECONDS,default=30"`
+	// ExportRetentionHours is how long an export archive is kept before it is removed
+	ExportRetentionHours int `env:"EXPORT_RETENTION_HOURS,default=72"`
+	// ExportDownloadURLMinutes is the lifetime of an export download link
+	ExportDownloadURLMinutes int `env:"EXPORT_DOWNLOAD_URL_MINUTES,default=15"`
+	// ProxyHeader is the header the load balancer puts the client IP in, e.g. X-Real-IP.
+	// Empty means the app is reached directly and the connection address is the client IP
+	ProxyHeader string `env:"PROXY_HEADER"`
+	// TrustedProxies is the comma separated IPs or CIDRs of the load balancers. ProxyHeader is only
+	// read from requests coming from them, so clients cannot pick their own IP
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
 
 	// S3Enabled is a flag which if set to true, will set image upload to s3
 	S3Enabled bool `env:"S3_ENABLED"`
 
 	// S3 stores config to connect to S3
 	S3 S3Config
+
+	// Notifier stores config to deliver emails and text messages
+	Notifier NotifierConfig
+
+	// LoginGuard stores config of the brute-force protection on login
+	LoginGuard LoginGuardConfig
+
+	// PasswordHasher stores config of password hashing
+	PasswordHasher PasswordHasherConfig
+
+	// OIDC stores config of the sign in with OpenID Connect providers
+	OIDC OIDCConfig
 }
 
 func InitializeConfig() Config {
@@ -2,32 +2,80 @@ package config
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
 	"github.com/gofiber/fiber/v2"
 	"github.com/pkg/errors"
 )
 
 var (
-	ErrMalformedRequest       = fiber.NewError(http.StatusBadRequest, "request malformed")
-	ErrCredentialExists       = fiber.NewError(http.StatusConflict, "credential already used")
-	ErrWrongPassword          = fiber.NewError(http.StatusBadRequest, "wrong password entered")
-	ErrRequestForbidden       = fiber.NewError(http.StatusForbidden, "request forbidden")
-	ErrCannotChangeCredential = fiber.NewError(http.StatusBadRequest, "cannot change email or phone from link email/phone API")
-	ErrUserNotFound           = fiber.NewError(http.StatusNotFound, "user with the specified credential not found")
-	ErrPostNotFound           = fiber.NewError(http.StatusNotFound, "post not found")
-	ErrPostCreatorIsNotFriend = fiber.NewError(http.StatusBadRequest, "you cannot comment a post which author is not on your friend list")
-	ErrTargetUserIDEmpty      = fiber.NewError(http.StatusBadRequest, "user ID is empty")
-	ErrSelfAddFriend          = fiber.NewError(http.StatusBadRequest, "cannot add yourself as a new friend")
-	ErrFriendAlreadyAdded     = fiber.NewError(http.StatusBadRequest, "user already added as friend")
-	ErrUserIsNotAFriend       = fiber.NewError(http.StatusBadRequest, "user is not a friend")
-	ErrInvalidUploadedFile    = fiber.NewError(http.StatusBadRequest, "invalid uploaded file")
-	ErrInvalidFileSize        = fiber.NewError(http.StatusBadRequest, "invalid file size")
-	ErrInvalidFileExtension   = fiber.NewError(http.StatusBadRequest, "invalid file extension")
+	ErrMalformedRequest         = fiber.NewError(http.StatusBadRequest, "request malformed")
+	ErrCredentialExists         = fiber.NewError(http.StatusConflict, "credential already used")
+	ErrWrongPassword            = fiber.NewError(http.StatusBadRequest, "wrong password entered")
+	ErrRequestForbidden         = fiber.NewError(http.StatusForbidden, "request forbidden")
+	ErrCannotChangeCredential   = fiber.NewError(http.StatusBadRequest, "cannot change email or phone from link email/phone API")
+	ErrUserNotFound             = fiber.NewError(http.StatusNotFound, "user with the specified credential not found")
+	ErrPostNotFound             = fiber.NewError(http.StatusNotFound, "post not found")
+	ErrPostCreatorIsNotFriend   = fiber.NewError(http.StatusBadRequest, "you cannot comment a post which author is not on your friend list")
+	ErrTargetUserIDEmpty        = fiber.NewError(http.StatusBadRequest, "user ID is empty")
+	ErrSelfAddFriend            = fiber.NewError(http.StatusBadRequest, "cannot add yourself as a new friend")
+	ErrFriendAlreadyAdded       = fiber.NewError(http.StatusBadRequest, "user already added as friend")
+	ErrUserIsNotAFriend         = fiber.NewError(http.StatusBadRequest, "user is not a friend")
+	ErrInvalidUploadedFile      = fiber.NewError(http.StatusBadRequest, "invalid uploaded file")
+	ErrInvalidFileSize          = fiber.NewError(http.StatusBadRequest, "invalid file size")
+	ErrInvalidFileExtension     = fiber.NewError(http.StatusBadRequest, "invalid file extension")
+	ErrInvalidRefreshToken      = fiber.NewError(http.StatusUnauthorized, "refresh token is invalid or expired")
+	ErrRefreshTokenReused       = fiber.NewError(http.StatusUnauthorized, "refresh token has already been used, please log in again")
+	ErrInvalidVerificationCode  = fiber.NewError(http.StatusBadRequest, "verification code is invalid or expired")
+	ErrVerificationCodeCooldown = fiber.NewError(http.StatusTooManyRequests, "a verification code was sent recently, please wait before requesting a new one")
+	ErrCredentialNotLinked      = fiber.NewError(http.StatusBadRequest, "no email or phone linked yet, use the link email/phone API instead")
+	ErrSameCredential           = fiber.NewError(http.StatusBadRequest, "new credential is the same as the current one")
+	ErrTooManyLoginAttempts     = fiber.NewError(http.StatusTooManyRequests, "too many failed login attempts, please try again later")
+	ErrTwoFactorAlreadyEnabled  = fiber.NewError(http.StatusConflict, "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled     = fiber.NewError(http.StatusBadRequest, "two-factor authentication is not enrolled")
+	ErrInvalidTwoFactorCode     = fiber.NewError(http.StatusBadRequest, "two-factor code is invalid")
+	ErrExportInProgress         = fiber.NewError(http.StatusConflict, "an export is already in progress")
+	ErrExportCooldown           = fiber.NewError(http.StatusTooManyRequests, "an export was requested recently, please wait before requesting a new one")
+	ErrExportNotFound           = fiber.NewError(http.StatusNotFound, "no export requested yet")
+	ErrUsernameTaken            = fiber.NewError(http.StatusConflict, "username already used")
+	ErrHandleNotFound           = fiber.NewError(http.StatusNotFound, "no user with this handle")
+	ErrCannotChangeOwnRole      = fiber.NewError(http.StatusBadRequest, "cannot change your own role")
+	ErrAccountBanned            = fiber.NewError(http.StatusForbidden, "account has been banned")
+	ErrCannotModerateStaff      = fiber.NewError(http.StatusForbidden, "moderators and admins cannot be suspended or banned")
+	ErrUserAlreadyBanned        = fiber.NewError(http.StatusConflict, "user is already banned")
+	ErrUserNotBanned            = fiber.NewError(http.StatusBadRequest, "user is not banned")
+	ErrUserNotSuspended         = fiber.NewError(http.StatusBadRequest, "user is not suspended")
+	ErrSessionNotFound          = fiber.NewError(http.StatusNotFound, "session not found")
+	ErrOIDCProviderNotFound     = fiber.NewError(http.StatusNotFound, "sign-in provider not found")
+	ErrInvalidOIDCState         = fiber.NewError(http.StatusBadRequest, "sign-in request is invalid or expired, please start again")
+	ErrOIDCLoginFailed          = fiber.NewError(http.StatusUnauthorized, "sign-in with the provider failed")
+	ErrOIDCEmailNotVerified     = fiber.NewError(http.StatusForbidden, "the provider did not confirm an email address, log in and link the provider from your account instead")
+	ErrOIDCAccountConflict      = fiber.NewError(http.StatusConflict, "an account with this email already exists, log in with it and link the provider from your account instead")
+	ErrIdentityAlreadyLinked    = fiber.NewError(http.StatusConflict, "this provider account is already linked to another user")
+	ErrProviderAlreadyLinked    = fiber.NewError(http.StatusConflict, "another account of this provider is already linked, unlink it first")
+	ErrIdentityNotFound         = fiber.NewError(http.StatusNotFound, "provider is not linked")
+	ErrCannotUnlinkLastLogin    = fiber.NewError(http.StatusBadRequest, "set a password before unlinking your only sign-in method")
+	ErrPersonalTokenLimit       = fiber.NewError(http.StatusConflict, "too many active tokens, revoke one before creating another")
+	ErrPersonalTokenNotFound    = fiber.NewError(http.StatusNotFound, "token not found")
+	ErrFriendRequestExists      = fiber.NewError(http.StatusConflict, "friend request already sent")
+	ErrFriendRequestReceived    = fiber.NewError(http.StatusConflict, "this user already sent you a friend request, accept it instead")
+	ErrFriendRequestNotFound    = fiber.NewError(http.StatusNotFound, "friend request not found")
 )
 
 func DefaultErrorHandler() fiber.ErrorHandler {
 	return func(c *fiber.Ctx, err error) error {
+		// field errors get their own code, so clients can tell them apart from other bad requests
+		var validationErrs validation.Errors
+		if errors.As(err, &validationErrs) {
+			return c.Status(fiber.StatusBadRequest).JSON(model.ErrorResponse{
+				Code:    "validation_failed",
+				Message: validationErrs.Error(),
+				Errors:  validationErrs,
+			})
+		}
+
 		// Status code defaults to 500
 		code := fiber.StatusInternalServerError
 		message := "internal server error"
@@ -41,7 +89,18 @@ func DefaultErrorHandler() fiber.ErrorHandler {
 
 		// Return status code with error message
 		return c.Status(code).JSON(model.ErrorResponse{
+			Code:    errorCode(code),
 			Message: message,
 		})
 	}
 }
+
+// errorCode turns the status into a machine-readable code, e.g. "not_found"
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
@@ -0,0 +1,142 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ProfileData struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	Username        string     `json:"username,omitempty"`
+	Email           string     `json:"email,omitempty"`
+	Phone           string     `json:"phone,omitempty"`
+	ImageURL        string     `json:"imageUrl,omitempty"`
+	Bio             string     `json:"bio,omitempty"`
+	CoverImageURL   string     `json:"coverImageUrl,omitempty"`
+	Location        string     `json:"location,omitempty"`
+	Website         string     `json:"website,omitempty"`
+	Birthday        string     `json:"birthday,omitempty"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+	PhoneVerifiedAt *time.Time `json:"phoneVerifiedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// FriendData leaves out the friend count of friends who hide their friend list from the user
+type FriendData struct {
+	UserID      string    `json:"userId"`
+	Name        string    `json:"name"`
+	ImageURL    string    `json:"imageUrl,omitempty"`
+	FriendCount *int      `json:"friendCount,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type PostData struct {
+	ID         string    `json:"postId"`
+	PostInHTML string    `json:"postInHtml"`
+	Tags       []string  `json:"tags"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type CommentData struct {
+	ID        string    `json:"commentId"`
+	PostID    string    `json:"postId"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Archive is everything exported for a user
+type Archive struct {
+	ExportedAt time.Time
+	Profile    ProfileData
+	Friends    []FriendData
+	Posts      []PostData
+	Comments   []CommentData
+}
+
+// the posts are rendered as text on purpose, the archive must not run whatever HTML was posted
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Segokuning data export of {{.Profile.Name}}</title>
+</head>
+<body>
+<h1>{{.Profile.Name}}</h1>
+<p>Exported at {{.ExportedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+<ul>
+{{if .Profile.Username}}<li>Handle: @{{.Profile.Username}}</li>{{end}}
+{{if .Profile.Email}}<li>Email: {{.Profile.Email}}</li>{{end}}
+{{if .Profile.Phone}}<li>Phone: {{.Profile.Phone}}</li>{{end}}
+{{if .Profile.Bio}}<li>Bio: {{.Profile.Bio}}</li>{{end}}
+{{if .Profile.Location}}<li>Location: {{.Profile.Location}}</li>{{end}}
+{{if .Profile.Website}}<li>Website: {{.Profile.Website}}</li>{{end}}
+{{if .Profile.Birthday}}<li>Birthday: {{.Profile.Birthday}}</li>{{end}}
+<li>Member since: {{.Profile.CreatedAt.Format "2006-01-02"}}</li>
+</ul>
+
+<h2>Friends ({{len .Friends}})</h2>
+<ul>
+{{range .Friends}}<li>{{.Name}}</li>
+{{end}}</ul>
+
+<h2>Posts ({{len .Posts}})</h2>
+{{range .Posts}}<article>
+<p><small>{{.CreatedAt.Format "2006-01-02 15:04"}}{{range .Tags}} #{{.}}{{end}}</small></p>
+<pre>{{.PostInHTML}}</pre>
+</article>
+{{end}}
+<h2>Comments ({{len .Comments}})</h2>
+<ul>
+{{range .Comments}}<li><small>{{.CreatedAt.Format "2006-01-02 15:04"}}</small> {{.Comment}}</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// Zip packs the archive as JSON files, for machines, along with an index.html, for humans
+func (a Archive) Zip() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	jsonFiles := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", a.Profile},
+		{"friends.json", a.Friends},
+		{"posts.json", a.Posts},
+		{"comments.json", a.Comments},
+	}
+	for _, file := range jsonFiles {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "zip.Create error")
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, errors.Wrapf(err, "encode %s error", file.name)
+		}
+	}
+
+	w, err := zw.Create("index.html")
+	if err != nil {
+		return nil, errors.Wrap(err, "zip.Create error")
+	}
+	if err := indexTemplate.Execute(w, a); err != nil {
+		return nil, errors.Wrap(err, "render index.html error")
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "zip.Close error")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/s3"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// exportCooldown limits how often a user may request a new archive
+const exportCooldown = 24 * time.Hour
+
+type exportHandler struct {
+	exportRepo  *ExportRepo
+	s3Provider  *s3.S3Provider
+	downloadTTL time.Duration
+}
+
+type ExportHandlerConfig struct {
+	ExportRepo  *ExportRepo
+	S3Provider  *s3.S3Provider
+	DownloadTTL time.Duration
+}
+
+func NewExportHandler(cfg ExportHandlerConfig) exportHandler {
+	return exportHandler{
+		exportRepo:  cfg.ExportRepo,
+		s3Provider:  cfg.S3Provider,
+		downloadTTL: cfg.DownloadTTL,
+	}
+}
+
+func (h *exportHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
+	group := r.Group("/v1/user/export")
+	authMiddleware := jwtProvider.Middleware()
+	group.Use(authMiddleware)
+
+	group.Post("/", h.RequestExport)
+	group.Get("/", h.GetExport)
+}
+
+func (h *exportHandler) RequestExport(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	job, err := h.requestExport(c.Context(), claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(model.DataResponse{
+		Message: "export requested, check back later for the download link",
+		Data:    newExportJobResponse(job),
+	})
+}
+
+func (h *exportHandler) requestExport(ctx context.Context, userID string) (Job, error) {
+	now := time.Now().UTC()
+
+	latest, err := h.exportRepo.GetLatestJob(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return Job{}, errors.Wrap(err, "GetLatestJob error")
+	}
+	if err == nil {
+		if latest.InProgress() {
+			return Job{}, config.ErrExportInProgress
+		}
+		if latest.Status != StatusFailed && now.Sub(latest.CreatedAt) < exportCooldown {
+			return Job{}, config.ErrExportCooldown
+		}
+	}
+
+	job := Job{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Status:    StatusPending,
+		CreatedAt: now,
+	}
+	err = h.exportRepo.CreateJob(ctx, nil, job)
+	if err != nil {
+		return Job{}, errors.Wrap(err, "CreateJob error")
+	}
+
+	return job, nil
+}
+
+func (h *exportHandler) GetExport(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	response, err := h.getExport(c.Context(), claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    response,
+	})
+}
+
+func (h *exportHandler) getExport(ctx context.Context, userID string) (ExportJobResponse, error) {
+	job, err := h.exportRepo.GetLatestJob(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ExportJobResponse{}, config.ErrExportNotFound
+		}
+
+		return ExportJobResponse{}, errors.Wrap(err, "GetLatestJob error")
+	}
+
+	response := newExportJobResponse(job)
+	if job.Status != StatusCompleted || !job.ObjectKey.Valid {
+		return response, nil
+	}
+
+	// the link must not outlive the archive
+	ttl := h.downloadTTL
+	if remaining := time.Until(job.ExpiresAt.Time); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		response.Status = StatusExpired
+		return response, nil
+	}
+
+	downloadURL, err := h.s3Provider.PresignGetObject(ctx, job.ObjectKey.String, ttl)
+	if err != nil {
+		return response, errors.Wrap(err, "PresignGetObject error")
+	}
+	downloadExpiresAt := time.Now().UTC().Add(ttl)
+	response.DownloadURL = downloadURL
+	response.DownloadExpiresAt = &downloadExpiresAt
+
+	return response, nil
+}
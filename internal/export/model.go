@@ -0,0 +1,33 @@
+package export
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	// StatusExpired jobs had their archive removed after the retention period
+	StatusExpired = "expired"
+)
+
+// Job is a request of a user for a copy of their data
+type Job struct {
+	ID           string         `db:"id"`
+	UserID       string         `db:"user_id"`
+	Status       string         `db:"status"`
+	ObjectKey    sql.NullString `db:"object_key"`
+	ErrorMessage sql.NullString `db:"error_message"`
+	StartedAt    sql.NullTime   `db:"started_at"`
+	CompletedAt  sql.NullTime   `db:"completed_at"`
+	ExpiresAt    sql.NullTime   `db:"expires_at"`
+	CreatedAt    time.Time      `db:"created_at"`
+}
+
+// InProgress reports whether the job is still waiting for, or being processed by, the worker
+func (j Job) InProgress() bool {
+	return j.Status == StatusPending || j.Status == StatusProcessing
+}
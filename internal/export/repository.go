@@ -0,0 +1,226 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ExportRepo struct {
+	db *sqlx.DB
+}
+
+func NewExportRepo(db *sqlx.DB) ExportRepo {
+	return ExportRepo{db: db}
+}
+
+func (r *ExportRepo) CreateJob(ctx context.Context, tx *sql.Tx, job Job) error {
+	query := `
+		INSERT INTO export_jobs
+			(id, user_id, status, created_at)
+		VALUES
+			(:id, :user_id, :status, :created_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, job)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *ExportRepo) GetLatestJob(ctx context.Context, userID string) (Job, error) {
+	var result Job
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			status,
+			object_key,
+			error_message,
+			started_at,
+			completed_at,
+			expires_at,
+			created_at
+		FROM
+			export_jobs
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at DESC
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, userID)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ClaimNextJob moves the oldest pending job to processing and returns it. Jobs stuck in processing
+// since before staleBefore, e.g. because the instance died, are claimed again.
+// It returns sql.ErrNoRows when there is nothing to do
+func (r *ExportRepo) ClaimNextJob(ctx context.Context, now, staleBefore time.Time) (Job, error) {
+	var result Job
+
+	query := `
+		UPDATE
+			export_jobs
+		SET
+			status = 'processing',
+			started_at = $1
+		WHERE
+			id = (
+				SELECT
+					id
+				FROM
+					export_jobs
+				WHERE
+					status = 'pending'
+					OR (status = 'processing' AND started_at < $2)
+				ORDER BY
+					created_at ASC
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+		RETURNING
+			id,
+			user_id,
+			status,
+			object_key,
+			error_message,
+			started_at,
+			completed_at,
+			expires_at,
+			created_at
+	`
+
+	err := r.db.GetContext(ctx, &result, query, now, staleBefore)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *ExportRepo) CompleteJob(ctx context.Context, tx *sql.Tx, id, objectKey string, completedAt, expiresAt time.Time) error {
+	query := `
+		UPDATE
+			export_jobs
+		SET
+			status = 'completed',
+			object_key = $2,
+			completed_at = $3,
+			expires_at = $4
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id, objectKey, completedAt, expiresAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, id, objectKey, completedAt, expiresAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *ExportRepo) FailJob(ctx context.Context, tx *sql.Tx, id, errorMessage string, completedAt time.Time) error {
+	query := `
+		UPDATE
+			export_jobs
+		SET
+			status = 'failed',
+			error_message = $2,
+			completed_at = $3
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id, errorMessage, completedAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, id, errorMessage, completedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListExpiredJobs returns completed jobs whose archive passed its retention period
+func (r *ExportRepo) ListExpiredJobs(ctx context.Context, now time.Time, limit int) ([]Job, error) {
+	result := []Job{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			status,
+			object_key,
+			error_message,
+			started_at,
+			completed_at,
+			expires_at,
+			created_at
+		FROM
+			export_jobs
+		WHERE
+			status = 'completed'
+			AND expires_at <= $1
+		ORDER BY
+			expires_at ASC
+		LIMIT $2
+	`
+
+	err := r.db.SelectContext(ctx, &result, query, now, limit)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *ExportRepo) ExpireJob(ctx context.Context, tx *sql.Tx, id string) error {
+	query := `
+		UPDATE
+			export_jobs
+		SET
+			status = 'expired'
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
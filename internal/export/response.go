@@ -0,0 +1,29 @@
+package export
+
+import "time"
+
+type ExportJobResponse struct {
+	ID                string     `json:"exportId"`
+	Status            string     `json:"status"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	CompletedAt       *time.Time `json:"completedAt"`
+	ExpiresAt         *time.Time `json:"expiresAt"`
+	DownloadURL       string     `json:"downloadUrl,omitempty"`
+	DownloadExpiresAt *time.Time `json:"downloadExpiresAt,omitempty"`
+}
+
+func newExportJobResponse(job Job) ExportJobResponse {
+	response := ExportJobResponse{
+		ID:        job.ID,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt,
+	}
+	if job.CompletedAt.Valid {
+		response.CompletedAt = &job.CompletedAt.Time
+	}
+	if job.ExpiresAt.Valid {
+		response.ExpiresAt = &job.ExpiresAt.Time
+	}
+
+	return response
+}
@@ -0,0 +1,265 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/friend"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/post"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/s3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// staleJobTimeout is how long a job may stay in processing before another worker takes it over
+	staleJobTimeout = 30 * time.Minute
+	friendsPageSize = 100
+	cleanupBatch    = 50
+)
+
+// Worker builds the archives of pending export jobs and removes them after the retention period
+type Worker struct {
+	exportRepo *ExportRepo
+	userRepo   *user.UserRepo
+	friendRepo *friend.FriendRepo
+	postRepo   *post.PostRepo
+	s3Provider *s3.S3Provider
+	interval   time.Duration
+	retention  time.Duration
+}
+
+type WorkerConfig struct {
+	ExportRepo *ExportRepo
+	UserRepo   *user.UserRepo
+	FriendRepo *friend.FriendRepo
+	PostRepo   *post.PostRepo
+	S3Provider *s3.S3Provider
+	Interval   time.Duration
+	Retention  time.Duration
+}
+
+func NewWorker(cfg WorkerConfig) *Worker {
+	return &Worker{
+		exportRepo: cfg.ExportRepo,
+		userRepo:   cfg.UserRepo,
+		friendRepo: cfg.FriendRepo,
+		postRepo:   cfg.PostRepo,
+		s3Provider: cfg.S3Provider,
+		interval:   cfg.Interval,
+		retention:  cfg.Retention,
+	}
+}
+
+// Run polls for jobs every interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.processPending(ctx); err != nil {
+				log.Printf("export worker failed: %v", err)
+			}
+			if err := w.removeExpired(ctx); err != nil {
+				log.Printf("export cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+// processPending processes jobs until none is left
+func (w *Worker) processPending(ctx context.Context) error {
+	for {
+		now := time.Now().UTC()
+
+		job, err := w.exportRepo.ClaimNextJob(ctx, now, now.Add(-staleJobTimeout))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+
+			return errors.Wrap(err, "ClaimNextJob error")
+		}
+
+		if err := w.process(ctx, job); err != nil {
+			log.Printf("export job %s failed: %v", job.ID, err)
+
+			err = w.exportRepo.FailJob(ctx, nil, job.ID, err.Error(), time.Now().UTC())
+			if err != nil {
+				return errors.Wrap(err, "FailJob error")
+			}
+		}
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job Job) error {
+	archive, err := w.collect(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	content, err := archive.Zip()
+	if err != nil {
+		return err
+	}
+
+	objectKey := fmt.Sprintf("exports/%s/%s.zip", job.UserID, job.ID)
+	err = w.s3Provider.PutPrivateObject(ctx, objectKey, "application/zip", bytes.NewReader(content))
+	if err != nil {
+		return errors.Wrap(err, "PutPrivateObject error")
+	}
+
+	now := time.Now().UTC()
+	err = w.exportRepo.CompleteJob(ctx, nil, job.ID, objectKey, now, now.Add(w.retention))
+	if err != nil {
+		return errors.Wrap(err, "CompleteJob error")
+	}
+
+	return nil
+}
+
+func (w *Worker) collect(ctx context.Context, userID string) (Archive, error) {
+	archive := Archive{
+		ExportedAt: time.Now().UTC(),
+		Friends:    []FriendData{},
+		Posts:      []PostData{},
+		Comments:   []CommentData{},
+	}
+
+	u, err := w.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return archive, errors.Wrap(err, "GetUserByID error")
+	}
+	archive.Profile = ProfileData{
+		ID:        u.ID,
+		Name:      u.Name,
+		Email:     u.Email.String,
+		Phone:     u.Phone.String,
+		ImageURL:  u.ImageURL.String,
+		CreatedAt: u.CreatedAt,
+
+		Username:      u.Username.String,
+		Bio:           u.Bio.String,
+		CoverImageURL: u.CoverImageURL.String,
+		Location:      u.Location.String,
+		Website:       u.Website.String,
+	}
+	if u.Birthday.Valid {
+		archive.Profile.Birthday = u.Birthday.Time.Format("2006-01-02")
+	}
+	if u.EmailVerifiedAt.Valid {
+		archive.Profile.EmailVerifiedAt = &u.EmailVerifiedAt.Time
+	}
+	if u.PhoneVerifiedAt.Valid {
+		archive.Profile.PhoneVerifiedAt = &u.PhoneVerifiedAt.Time
+	}
+
+	for offset := uint(0); ; offset += friendsPageSize {
+		friends, _, err := w.friendRepo.ListFriends(ctx, friend.FindFriendsRequest{
+			UserID:     userID,
+			OnlyFriend: true,
+			SortBy:     "createdAt",
+			OrderBy:    "asc",
+			Limit:      friendsPageSize,
+			Offset:     offset,
+		})
+		if err != nil {
+			return archive, errors.Wrap(err, "ListFriends error")
+		}
+
+		for _, f := range friends {
+			friendData := FriendData{
+				UserID:    f.UserID,
+				Name:      f.Name,
+				ImageURL:  f.ImageURL.String,
+				CreatedAt: f.CreatedAt,
+			}
+			if f.FriendCount.Valid {
+				friendCount := int(f.FriendCount.Int64)
+				friendData.FriendCount = &friendCount
+			}
+
+			archive.Friends = append(archive.Friends, friendData)
+		}
+
+		if len(friends) < friendsPageSize {
+			break
+		}
+	}
+
+	posts, err := w.postRepo.ListPostsByUser(ctx, userID)
+	if err != nil {
+		return archive, errors.Wrap(err, "ListPostsByUser error")
+	}
+
+	if len(posts) > 0 {
+		postIDs := make([]string, 0, len(posts))
+		for _, p := range posts {
+			postIDs = append(postIDs, p.ID)
+		}
+
+		tags, err := w.postRepo.BulkGetPostTags(ctx, postIDs)
+		if err != nil {
+			return archive, errors.Wrap(err, "BulkGetPostTags error")
+		}
+
+		for _, p := range posts {
+			postTags := tags[p.ID]
+			if postTags == nil {
+				postTags = []string{}
+			}
+
+			archive.Posts = append(archive.Posts, PostData{
+				ID:         p.ID,
+				PostInHTML: p.PostInHTML,
+				Tags:       postTags,
+				CreatedAt:  p.CreatedAt,
+			})
+		}
+	}
+
+	comments, err := w.postRepo.ListCommentsByUser(ctx, userID)
+	if err != nil {
+		return archive, errors.Wrap(err, "ListCommentsByUser error")
+	}
+	for _, c := range comments {
+		archive.Comments = append(archive.Comments, CommentData{
+			ID:        c.ID,
+			PostID:    c.PostID,
+			Comment:   c.Comment,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+
+	return archive, nil
+}
+
+// removeExpired deletes the archives past their retention period
+func (w *Worker) removeExpired(ctx context.Context) error {
+	jobs, err := w.exportRepo.ListExpiredJobs(ctx, time.Now().UTC(), cleanupBatch)
+	if err != nil {
+		return errors.Wrap(err, "ListExpiredJobs error")
+	}
+
+	for _, job := range jobs {
+		if job.ObjectKey.Valid {
+			if err := w.s3Provider.DeleteObject(ctx, job.ObjectKey.String); err != nil {
+				return errors.Wrapf(err, "delete archive of job %s error", job.ID)
+			}
+		}
+
+		if err := w.exportRepo.ExpireJob(ctx, nil, job.ID); err != nil {
+			return errors.Wrap(err, "ExpireJob error")
+		}
+	}
+
+	return nil
+}
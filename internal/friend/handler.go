@@ -6,8 +6,10 @@ import (
 
 	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/personaltoken"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
 	"github.com/gofiber/fiber/v2"
 	"github.com/pkg/errors"
 )
@@ -34,12 +36,21 @@ func NewFriendHandler(cfg FriendHandlerConfig) friendHandler {
 
 func (h *friendHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
 	group := r.Group("/v1/friend")
-	authMiddleware := jwtProvider.Middleware()
-	group.Use(authMiddleware)
-
-	group.Get("/", h.FindFriends)
-	group.Post("/", h.AddFriend)
-	group.Delete("/", h.DeleteFriend)
+	// personal access tokens are accepted with the matching scope
+	readMiddleware := jwtProvider.Middleware(personaltoken.ScopeFriendRead)
+	writeMiddleware := jwtProvider.Middleware(personaltoken.ScopeFriendWrite)
+
+	group.Get("/", readMiddleware, h.FindFriends)
+	// kept for existing clients, adding a friend sends them a request like the route below
+	group.Post("/", writeMiddleware, h.SendFriendRequest)
+	group.Delete("/", writeMiddleware, h.DeleteFriend)
+
+	group.Get("/requests/incoming", readMiddleware, h.ListIncomingRequests)
+	group.Get("/requests/outgoing", readMiddleware, h.ListOutgoingRequests)
+	group.Post("/requests", writeMiddleware, h.SendFriendRequest)
+	group.Delete("/requests/outgoing/:userId<guid>", writeMiddleware, h.CancelFriendRequest)
+	group.Post("/requests/incoming/:userId<guid>/accept", writeMiddleware, h.AcceptFriendRequest)
+	group.Post("/requests/incoming/:userId<guid>/decline", writeMiddleware, h.DeclineFriendRequest)
 }
 
 func (h *friendHandler) FindFriends(c *fiber.Ctx) error {
@@ -55,7 +66,7 @@ func (h *friendHandler) FindFriends(c *fiber.Ctx) error {
 	}
 	payload.Queries = c.Queries()
 	if err := payload.Validate(); err != nil {
-		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+		return err
 	}
 
 	userResponses, meta, err := h.getFriends(c.Context(), payload)
@@ -82,13 +93,21 @@ func (h *friendHandler) getFriends(ctx context.Context, payload FindFriendsReque
 	}
 
 	for _, user := range users {
-		userResponses = append(userResponses, FriendResponse{
-			UserID:      user.UserID,
-			Name:        user.Name,
-			ImageURL:    user.ImageURL.String,
-			FriendCount: user.FriendCount,
-			CreatedAt:   user.CreatedAt,
-		})
+		response := FriendResponse{
+			UserID:    user.UserID,
+			Name:      user.Name,
+			ImageURL:  user.ImageURL.String,
+			Username:  user.Username.String,
+			Bio:       user.Bio.String,
+			Location:  user.Location.String,
+			CreatedAt: user.CreatedAt,
+		}
+		if user.FriendCount.Valid {
+			friendCount := int(user.FriendCount.Int64)
+			response.FriendCount = &friendCount
+		}
+
+		userResponses = append(userResponses, response)
 	}
 
 	meta.Limit = payload.Limit
@@ -98,7 +117,8 @@ func (h *friendHandler) getFriends(ctx context.Context, payload FindFriendsReque
 	return userResponses, meta, nil
 }
 
-func (h *friendHandler) AddFriend(c *fiber.Ctx) error {
+// SendFriendRequest asks the user to become friends, they are only added once the request is accepted
+func (h *friendHandler) SendFriendRequest(c *fiber.Ctx) error {
 	var payload AddFriendRequest
 	claims, err := jwt.GetLoggedInUser(c)
 	if err != nil {
@@ -110,17 +130,17 @@ func (h *friendHandler) AddFriend(c *fiber.Ctx) error {
 		return errors.Wrap(config.ErrMalformedRequest, err.Error())
 	}
 
-	err = h.addFriend(c.Context(), payload)
+	err = h.sendFriendRequest(c.Context(), payload)
 	if err != nil {
 		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
-		Message: "user added as friend",
+		Message: "friend request sent",
 	})
 }
 
-func (h *friendHandler) addFriend(ctx context.Context, payload AddFriendRequest) error {
+func (h *friendHandler) sendFriendRequest(ctx context.Context, payload AddFriendRequest) error {
 	// check if user ID to be added as friend is empty
 	if payload.TargetUserID == "" {
 		return config.ErrMalformedRequest
@@ -150,21 +170,129 @@ func (h *friendHandler) addFriend(ctx context.Context, payload AddFriendRequest)
 		return config.ErrFriendAlreadyAdded
 	}
 
-	// case: friend is not added yet. begin transaction
-	// which will add each other as friend, then increment friendCount for each user by 1
+	// a request the other way round is waiting for this user to answer it
+	status, err := h.friendRepo.GetRequestStatus(ctx, targetFriend.ID, payload.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "GetRequestStatus error")
+	}
+	if status == StatusPending {
+		return config.ErrFriendRequestReceived
+	}
+
+	err = h.friendRepo.CreateRequest(ctx, nil, payload.UserID, targetFriend.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrFriendRequestExists
+		}
+
+		return errors.Wrap(err, "CreateRequest error")
+	}
+
+	return nil
+}
+
+func (h *friendHandler) ListIncomingRequests(c *fiber.Ctx) error {
+	return h.listRequests(c, DirectionIncoming)
+}
+
+func (h *friendHandler) ListOutgoingRequests(c *fiber.Ctx) error {
+	return h.listRequests(c, DirectionOutgoing)
+}
+
+func (h *friendHandler) listRequests(c *fiber.Ctx, direction string) error {
+	var payload ListFriendRequestsRequest
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	if err := c.QueryParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+	payload.UserID = claims.UserID
+	payload.Direction = direction
+
+	requests, count, err := h.friendRepo.ListRequests(c.Context(), payload)
+	if err != nil {
+		return errors.Wrap(err, "ListRequests error")
+	}
+
+	responses := []FriendRequestResponse{}
+	for _, request := range requests {
+		responses = append(responses, newFriendRequestResponse(request))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "ok",
+		Data:    responses,
+		Meta: &model.ResponseMeta{
+			Limit:  payload.Limit,
+			Offset: payload.Offset,
+			Total:  uint(count),
+		},
+	})
+}
+
+func (h *friendHandler) CancelFriendRequest(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	err = h.friendRepo.CancelRequest(c.Context(), nil, claims.UserID, c.Params("userId"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrFriendRequestNotFound
+		}
+
+		return errors.Wrap(err, "CancelRequest error")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "friend request cancelled",
+	})
+}
+
+func (h *friendHandler) AcceptFriendRequest(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	err = h.acceptFriendRequest(c.Context(), c.Params("userId"), claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "friend request accepted",
+	})
+}
+
+func (h *friendHandler) acceptFriendRequest(ctx context.Context, requesterID, userID string) error {
+	// accept the request which will add each other as friend,
+	// then increment friendCount for each user by 1
 	tx, err := h.txProvider.NewTransaction(ctx)
 	if err != nil {
 		return errors.Wrap(err, "NewTransaction error")
 	}
 	defer tx.Rollback()
 
-	err = h.friendRepo.AddAsFriend(ctx, tx, payload.UserID, targetFriend.ID)
+	err = h.friendRepo.AcceptRequest(ctx, tx, requesterID, userID)
 	if err != nil {
-		return errors.Wrap(err, "AddAsFriend error")
+		if err == sql.ErrNoRows {
+			return config.ErrFriendRequestNotFound
+		}
+
+		return errors.Wrap(err, "AcceptRequest error")
 	}
 
 	// increment both friendCount counter
-	err = h.userRepo.IncrementFriendCounter(ctx, tx, payload.UserID, targetFriend.ID)
+	err = h.userRepo.IncrementFriendCounter(ctx, tx, userID, requesterID)
 	if err != nil {
 		return errors.Wrap(err, "IncrementFriendCounter error")
 	}
@@ -177,6 +305,26 @@ func (h *friendHandler) addFriend(ctx context.Context, payload AddFriendRequest)
 	return nil
 }
 
+func (h *friendHandler) DeclineFriendRequest(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	err = h.friendRepo.DeclineRequest(c.Context(), nil, c.Params("userId"), claims.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrFriendRequestNotFound
+		}
+
+		return errors.Wrap(err, "DeclineRequest error")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "friend request declined",
+	})
+}
+
 func (h *friendHandler) DeleteFriend(c *fiber.Ctx) error {
 	var payload DeleteFriendRequest
 	claims, err := jwt.GetLoggedInUser(c)
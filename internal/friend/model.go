@@ -2,9 +2,24 @@ package friend
 
 import (
 	"database/sql"
-	"errors"
 	"strings"
 	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+)
+
+// statuses of a user_friends row. A request is a single pending row from the sender to the
+// recipient, accepting it confirms the row and adds the confirmed row of the other direction
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusDeclined  = "declined"
+)
+
+// directions of the friend requests listed
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
 )
 
 type FindFriendsRequest struct {
@@ -30,35 +45,34 @@ var allowedOrderByKey = map[string]bool{
 }
 
 func (r *FindFriendsRequest) Validate() error {
+	var validationErrs validation.Errors
 	queries := r.Queries
 
 	if val, ok := queries["limit"]; ok && val == "" {
-		return errors.New("limit is empty")
+		validationErrs.Add("limit", "required", "is empty")
 	}
 
 	if val, ok := queries["offset"]; ok && val == "" {
-		return errors.New("offset is empty")
+		validationErrs.Add("offset", "required", "is empty")
 	}
 
 	if val, ok := queries["sortBy"]; ok && val == "" {
-		return errors.New("sortBy is empty")
-	}
-	if _, found := allowedSortByKey[strings.ToLower(r.SortBy)]; r.SortBy != "" && !found {
-		return errors.New("sortBy has invalid value")
+		validationErrs.Add("sortBy", "required", "is empty")
+	} else if _, found := allowedSortByKey[strings.ToLower(r.SortBy)]; r.SortBy != "" && !found {
+		validationErrs.Add("sortBy", "oneof", "must be one of: friendCount, createdAt")
 	}
 
 	if val, ok := queries["orderBy"]; ok && val == "" {
-		return errors.New("orderBy is empty")
-	}
-	if _, found := allowedOrderByKey[strings.ToLower(r.OrderBy)]; r.SortBy != "" && !found {
-		return errors.New("orderBy has invalid value")
+		validationErrs.Add("orderBy", "required", "is empty")
+	} else if _, found := allowedOrderByKey[strings.ToLower(r.OrderBy)]; r.SortBy != "" && !found {
+		validationErrs.Add("orderBy", "oneof", "must be one of: asc, desc")
 	}
 
 	if val, ok := queries["onlyFriend"]; ok && val == "" {
-		return errors.New("onlyFriend is empty")
+		validationErrs.Add("onlyFriend", "required", "is empty")
 	}
 
-	return nil
+	return validationErrs.Err()
 }
 
 type AddFriendRequest struct {
@@ -71,11 +85,33 @@ type DeleteFriendRequest struct {
 	UserID       string
 }
 
+type ListFriendRequestsRequest struct {
+	Limit  uint `query:"limit" validate:"max=100"`
+	Offset uint `query:"offset"`
+
+	Direction string
+	UserID    string
+}
+
+// FriendRequest is a pending request along with the other user, the sender for incoming
+// requests and the recipient for outgoing ones
+type FriendRequest struct {
+	UserID      string         `db:"user_id"`
+	Name        string         `db:"name"`
+	Username    sql.NullString `db:"username"`
+	ImageURL    sql.NullString `db:"image_url"`
+	RequestedAt time.Time      `db:"requested_at"`
+}
+
+// UserFriend has a null FriendCount when the user hides their friend list from the querying user
 type UserFriend struct {
 	UserID      string         `db:"user_id"`
 	Name        string         `db:"name"`
+	Username    sql.NullString `db:"username"`
 	ImageURL    sql.NullString `db:"image_url"`
-	FriendCount int            `db:"friend_count"`
+	FriendCount sql.NullInt64  `db:"friend_count"`
+	Bio         sql.NullString `db:"bio"`
+	Location    sql.NullString `db:"location"`
 	// CreatedAt is the user's register time, not when the friend request is created
 	CreatedAt time.Time `db:"user_created_at"`
 }
@@ -24,7 +24,7 @@ func (r *FriendRepo) IsUserFriendWith(ctx context.Context, userID, friendID stri
 		SELECT EXISTS(
 			SELECT 1
 			FROM user_friends
-			WHERE user_id_1=$1 AND user_id_2=$2
+			WHERE user_id_1=$1 AND user_id_2=$2 AND status='confirmed'
 		) AS "exists"
 	`
 
@@ -36,6 +36,32 @@ func (r *FriendRepo) IsUserFriendWith(ctx context.Context, userID, friendID stri
 	return isFriend, nil
 }
 
+// CountMutualFriends counts the users who are friends with both userID and otherID
+func (r *FriendRepo) CountMutualFriends(ctx context.Context, userID, otherID string) (int, error) {
+	var count int
+
+	query := `
+		SELECT
+			COUNT(*)
+		FROM
+			user_friends uf1
+			INNER JOIN user_friends uf2
+			ON uf1.user_id_2 = uf2.user_id_2
+		WHERE
+			uf1.user_id_1 = $1
+			AND uf2.user_id_1 = $2
+			AND uf1.status = 'confirmed'
+			AND uf2.status = 'confirmed'
+	`
+
+	err := r.db.GetContext(ctx, &count, query, userID, otherID)
+	if err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
 func (r *FriendRepo) ListFriends(ctx context.Context, req FindFriendsRequest) ([]UserFriend, int, error) {
 	var friends []UserFriend
 
@@ -43,16 +69,26 @@ func (r *FriendRepo) ListFriends(ctx context.Context, req FindFriendsRequest) ([
 		SELECT
 			u.id AS user_id,
 			u.name AS name,
+			u.username AS username,
 			u.image_url AS image_url,
-			u.friend_count AS friend_count,
+			-- the friend count is part of the friend list, it is hidden the same way
+			CASE
+				WHEN COALESCE(ps.friend_list_visibility, 'everyone') = 'everyone' THEN u.friend_count
+				WHEN ps.friend_list_visibility = 'friends' AND uf.user_id_2 IS NOT NULL THEN u.friend_count
+			END AS friend_count,
+			u.bio AS bio,
+			u.location AS location,
 			u.created_at AS user_created_at
 		FROM
 			users u
+			LEFT JOIN user_privacy_settings ps
+			ON ps.user_id = u.id
+			LEFT JOIN user_friends uf
+			ON uf.user_id_1 = ? AND uf.user_id_2 = u.id AND uf.status = 'confirmed'
 		%s
 	`
 
-	// exclude the querying user
-	args := []interface{}{}
+	args := []interface{}{req.UserID}
 
 	filterQuery, filterArgs := getFilter(req)
 
@@ -85,12 +121,16 @@ func getFilter(req FindFriendsRequest) (string, []interface{}) {
 	args := []interface{}{}
 	filters := []string{}
 
+	// exclude the querying user
 	filters = append(filters, "u.id != ?")
 	args = append(args, req.UserID)
 
+	// uf is the querying user's friendship with u, joined in ListFriends
 	if req.OnlyFriend {
-		filters = append(filters, "u.id = ANY(SELECT user_id_2 FROM user_friends WHERE user_id_1 = ?)")
-		args = append(args, req.UserID)
+		filters = append(filters, "uf.user_id_2 IS NOT NULL")
+	} else {
+		// users who turned discoverability off are only found by their friends
+		filters = append(filters, "(COALESCE(ps.discoverable, TRUE) OR uf.user_id_2 IS NOT NULL)")
 	}
 
 	if req.Search != "" {
@@ -106,15 +146,16 @@ func getFilter(req FindFriendsRequest) (string, []interface{}) {
 	return filter, args
 }
 
+// friend_count is the selected one, so hidden friend counts do not give away their order
 var sortKeyToColumnMap = map[string]string{
 	"friendCount": "friend_count",
-	"createdAt":   "created_at",
+	"createdAt":   "u.created_at",
 }
 
 func getSortBy(req FindFriendsRequest) string {
 	sortColumn := sortKeyToColumnMap[req.SortBy]
 	if sortColumn == "" {
-		sortColumn = "created_at"
+		sortColumn = "u.created_at"
 	}
 
 	sortOrdering := strings.ToUpper(req.OrderBy)
@@ -124,7 +165,7 @@ func getSortBy(req FindFriendsRequest) string {
 
 	query := fmt.Sprintf(`
 		ORDER BY
-			u.%s %s 
+			%s %s NULLS LAST
 	`, sortColumn, sortOrdering)
 
 	return query
@@ -147,31 +188,232 @@ func getLimitAndOffset(req FindFriendsRequest) (string, []interface{}) {
 	return query, args
 }
 
-func (r *FriendRepo) AddAsFriend(ctx context.Context, tx *sql.Tx, userID, friendID string) error {
-	// 2 rows will be added:
-	// 1. userID -> friendID (userID has friendID as friend)
-	// 2. friendID -> userID (friendID has userID as friend)
+// GetRequestStatus returns the status of the row from userID to otherID.
+// Returns sql.ErrNoRows when userID never sent otherID a request
+func (r *FriendRepo) GetRequestStatus(ctx context.Context, userID, otherID string) (string, error) {
+	var status string
+
+	query := `
+		SELECT
+			status
+		FROM
+			user_friends
+		WHERE
+			user_id_1 = $1
+			AND user_id_2 = $2
+	`
+
+	err := r.db.GetContext(ctx, &status, query, userID, otherID)
+	if err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// CreateRequest adds a pending request from userID to friendID, replacing a request friendID declined.
+// Returns sql.ErrNoRows when a pending request or a friendship already exists
+func (r *FriendRepo) CreateRequest(ctx context.Context, tx *sql.Tx, userID, friendID string) error {
+	query := `
+		INSERT INTO
+			user_friends
+			(user_id_1, user_id_2, status)
+		VALUES
+			($1, $2, 'pending')
+		ON CONFLICT (user_id_1, user_id_2) DO UPDATE SET
+			status = 'pending',
+			created_at = NOW(),
+			updated_at = NOW()
+		WHERE
+			user_friends.status = 'declined'
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, friendID)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, friendID)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// AcceptRequest confirms the pending request from requesterID to userID and adds the confirmed
+// row of the other direction. Returns sql.ErrNoRows when there is no pending request
+func (r *FriendRepo) AcceptRequest(ctx context.Context, tx *sql.Tx, requesterID, userID string) error {
+	err := r.setRequestStatus(ctx, tx, requesterID, userID, StatusConfirmed)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO
 			user_friends
-			(user_id_1, user_id_2)
+			(user_id_1, user_id_2, status)
 		VALUES
-			($1, $2), ($2, $1)
+			($1, $2, 'confirmed')
+		ON CONFLICT (user_id_1, user_id_2) DO UPDATE SET
+			status = 'confirmed',
+			updated_at = NOW()
 	`
 
-	var err error
 	if tx != nil {
-		_, err = tx.ExecContext(ctx, query, userID, friendID)
+		_, err = tx.ExecContext(ctx, query, userID, requesterID)
 	} else {
-		_, err = r.db.ExecContext(ctx, query, userID, friendID)
+		_, err = r.db.ExecContext(ctx, query, userID, requesterID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeclineRequest keeps the declined request so it is not listed again.
+// Returns sql.ErrNoRows when there is no pending request
+func (r *FriendRepo) DeclineRequest(ctx context.Context, tx *sql.Tx, requesterID, userID string) error {
+	return r.setRequestStatus(ctx, tx, requesterID, userID, StatusDeclined)
+}
+
+func (r *FriendRepo) setRequestStatus(ctx context.Context, tx *sql.Tx, requesterID, userID, status string) error {
+	query := `
+		UPDATE
+			user_friends
+		SET
+			status = $3,
+			updated_at = NOW()
+		WHERE
+			user_id_1 = $1
+			AND user_id_2 = $2
+			AND status = 'pending'
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, requesterID, userID, status)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, requesterID, userID, status)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CancelRequest removes the pending request from userID to friendID.
+// Returns sql.ErrNoRows when there is no pending request
+func (r *FriendRepo) CancelRequest(ctx context.Context, tx *sql.Tx, userID, friendID string) error {
+	query := `
+		DELETE FROM
+			user_friends
+		WHERE
+			user_id_1 = $1
+			AND user_id_2 = $2
+			AND status = 'pending'
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, friendID)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, friendID)
 	}
 	if err != nil {
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
 	return nil
 }
 
+// ListRequests returns the pending requests sent to the user, or sent by the user, newest first
+func (r *FriendRepo) ListRequests(ctx context.Context, req ListFriendRequestsRequest) ([]FriendRequest, int, error) {
+	requests := []FriendRequest{}
+
+	// incoming requests are listed with their sender, outgoing ones with their recipient
+	ownColumn, otherColumn := "user_id_2", "user_id_1"
+	if req.Direction == DirectionOutgoing {
+		ownColumn, otherColumn = "user_id_1", "user_id_2"
+	}
+
+	baseQuery := fmt.Sprintf(`
+		FROM
+			user_friends uf
+			INNER JOIN users u
+			ON u.id = uf.%s
+		WHERE
+			uf.%s = $1
+			AND uf.status = 'pending'
+	`, otherColumn, ownColumn)
+
+	var count int
+	err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) "+baseQuery, req.UserID)
+	if err != nil {
+		return requests, count, err
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = 10
+	}
+
+	query := `
+		SELECT
+			u.id AS user_id,
+			u.name AS name,
+			u.username AS username,
+			u.image_url AS image_url,
+			uf.created_at AS requested_at
+	` + baseQuery + `
+		ORDER BY
+			uf.created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	err = r.db.SelectContext(ctx, &requests, query, req.UserID, limit, req.Offset)
+	if err != nil {
+		return requests, count, err
+	}
+
+	return requests, count, nil
+}
+
 func (r *FriendRepo) DeleteFriend(ctx context.Context, tx *sql.Tx, userID, friendID string) error {
 	// 2 rows will be removed:
 	// 1. userID -> friendID (userID has friendID as friend)
@@ -2,11 +2,33 @@ package friend
 
 import "time"
 
+// FriendResponse has a null friendCount when the user hides their friend list from the viewer
 type FriendResponse struct {
 	UserID      string `json:"userId"`
 	Name        string `json:"name"`
+	Username    string `json:"username"`
 	ImageURL    string `json:"imageUrl"`
-	FriendCount int    `json:"friendCount"`
+	FriendCount *int   `json:"friendCount"`
+	Bio         string `json:"bio"`
+	Location    string `json:"location"`
 	// CreatedAt is the user's register time, not when the friend request is created
 	CreatedAt time.Time `json:"createdAt"`
 }
+
+type FriendRequestResponse struct {
+	UserID      string    `json:"userId"`
+	Name        string    `json:"name"`
+	Username    string    `json:"username"`
+	ImageURL    string    `json:"imageUrl"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+func newFriendRequestResponse(request FriendRequest) FriendRequestResponse {
+	return FriendRequestResponse{
+		UserID:      request.UserID,
+		Name:        request.Name,
+		Username:    request.Username.String,
+		ImageURL:    request.ImageURL.String,
+		RequestedAt: request.RequestedAt,
+	}
+}
@@ -0,0 +1,30 @@
+package identity
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Identity links an account at an OpenID Connect provider to a user
+type Identity struct {
+	ID       string `db:"id"`
+	UserID   string `db:"user_id"`
+	Provider string `db:"provider"`
+	// Subject is the "sub" claim of the provider's ID tokens
+	Subject     string         `db:"subject"`
+	Email       sql.NullString `db:"email"`
+	CreatedAt   time.Time      `db:"created_at"`
+	LastLoginAt sql.NullTime   `db:"last_login_at"`
+}
+
+// LoginState keeps what is needed to finish an authorization started with the provider.
+// It is consumed by the callback, so a state can only be used once
+type LoginState struct {
+	State        string `db:"state"`
+	Provider     string `db:"provider"`
+	Nonce        string `db:"nonce"`
+	CodeVerifier string `db:"code_verifier"`
+	// UserID is set when the authorization links the provider to a logged in user instead of logging in
+	UserID    sql.NullString `db:"user_id"`
+	ExpiresAt time.Time      `db:"expires_at"`
+}
@@ -0,0 +1,218 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IdentityRepo struct {
+	db *sqlx.DB
+}
+
+func NewIdentityRepo(db *sqlx.DB) IdentityRepo {
+	return IdentityRepo{db: db}
+}
+
+func (r *IdentityRepo) CreateIdentity(ctx context.Context, tx *sql.Tx, identity Identity) error {
+	query := `
+		INSERT INTO user_identities
+			(id, user_id, provider, subject, email, last_login_at)
+		VALUES
+			(:id, :user_id, :provider, :subject, :email, :last_login_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, identity)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *IdentityRepo) GetIdentityBySubject(ctx context.Context, provider, subject string) (Identity, error) {
+	var result Identity
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			provider,
+			subject,
+			email,
+			created_at,
+			last_login_at
+		FROM
+			user_identities
+		WHERE
+			provider = $1
+			AND subject = $2
+	`
+
+	err := r.db.GetContext(ctx, &result, query, provider, subject)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *IdentityRepo) ListUserIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	identities := []Identity{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			provider,
+			subject,
+			email,
+			created_at,
+			last_login_at
+		FROM
+			user_identities
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at ASC
+	`
+
+	err := r.db.SelectContext(ctx, &identities, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// DeleteIdentity unlinks the provider from the user. Returns sql.ErrNoRows when it was not linked
+func (r *IdentityRepo) DeleteIdentity(ctx context.Context, tx *sql.Tx, userID, provider string) error {
+	query := `
+		DELETE FROM
+			user_identities
+		WHERE
+			user_id = $1
+			AND provider = $2
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, provider)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, provider)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *IdentityRepo) UpdateLastLogin(ctx context.Context, identityID string, loggedInAt time.Time) error {
+	query := `
+		UPDATE
+			user_identities
+		SET
+			last_login_at = $2
+		WHERE
+			id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, identityID, loggedInAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *IdentityRepo) CreateLoginState(ctx context.Context, state LoginState) error {
+	query := `
+		INSERT INTO oidc_login_states
+			(state, provider, nonce, code_verifier, user_id, expires_at)
+		VALUES
+			(:state, :provider, :nonce, :code_verifier, :user_id, :expires_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, state)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeLoginState deletes the state and returns it, so it cannot be used twice. userID is the user
+// finishing a link, empty when finishing a login, so a state is only usable by whoever started it.
+// Returns sql.ErrNoRows when the state is unknown, expired or was started for another provider or user
+func (r *IdentityRepo) ConsumeLoginState(ctx context.Context, state, provider, userID string, now time.Time) (LoginState, error) {
+	var result LoginState
+
+	query := `
+		DELETE FROM
+			oidc_login_states
+		WHERE
+			state = $1
+			AND provider = $2
+			AND user_id IS NOT DISTINCT FROM $3
+			AND expires_at > $4
+		RETURNING
+			state,
+			provider,
+			nonce,
+			code_verifier,
+			user_id,
+			expires_at
+	`
+
+	err := r.db.GetContext(ctx, &result, query, state, provider, sql.NullString{String: userID, Valid: userID != ""}, now)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// DeleteExpiredLoginStates removes the authorizations which were started but never finished
+func (r *IdentityRepo) DeleteExpiredLoginStates(ctx context.Context, now time.Time) error {
+	query := `
+		DELETE FROM
+			oidc_login_states
+		WHERE
+			expires_at <= $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
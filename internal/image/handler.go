@@ -2,35 +2,45 @@ package image
 
 import (
 	"strings"
+	"time"
 
 	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/personaltoken"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/s3"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
 type imageHandler struct {
 	s3Provider *s3.S3Provider
+	imageRepo  *ImageRepo
 }
 
-func NewImageHandler(s3prov *s3.S3Provider) imageHandler {
+type ImageHandlerConfig struct {
+	S3Provider *s3.S3Provider
+	ImageRepo  *ImageRepo
+}
+
+func NewImageHandler(cfg ImageHandlerConfig) imageHandler {
 	return imageHandler{
-		s3Provider: s3prov,
+		s3Provider: cfg.S3Provider,
+		imageRepo:  cfg.ImageRepo,
 	}
 }
 
 func (h *imageHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
 	imageGroup := r.Group("/v1/image")
-	authMiddleware := jwtProvider.Middleware()
+	authMiddleware := jwtProvider.Middleware(personaltoken.ScopeImageWrite)
 
 	imageGroup.Post("/", authMiddleware, h.UploadImage)
 }
 
 func (h *imageHandler) UploadImage(c *fiber.Ctx) error {
 	// check for credentials
-	_, err := jwt.GetLoggedInUser(c)
+	claims, err := jwt.GetLoggedInUser(c)
 	if err != nil {
 		return config.ErrRequestForbidden
 	}
@@ -52,11 +62,25 @@ func (h *imageHandler) UploadImage(c *fiber.Ctx) error {
 		return config.ErrInvalidFileExtension
 	}
 
-	imgUrl, err := h.s3Provider.UploadImage(c.Context(), fileReader)
+	ctx := c.Context()
+	imgUrl, err := h.s3Provider.UploadImage(ctx, fileReader)
 	if err != nil {
 		return err
 	}
 
+	// remember the owner so the object is removed when the account is deleted
+	if objectKey, ok := h.s3Provider.KeyFromURL(imgUrl); ok {
+		err = h.imageRepo.CreateUpload(ctx, nil, Upload{
+			ID:        uuid.NewString(),
+			UserID:    claims.UserID,
+			ObjectKey: objectKey,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "CreateUpload error")
+		}
+	}
+
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
 		Message: "File uploaded successfully",
 		Data: ImageUploadResponse{
@@ -0,0 +1,11 @@
+package image
+
+import "time"
+
+// Upload records which user uploaded an S3 object, so it can be removed with the account
+type Upload struct {
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	ObjectKey string    `db:"object_key"`
+	CreatedAt time.Time `db:"created_at"`
+}
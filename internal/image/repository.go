@@ -0,0 +1,41 @@
+package image
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ImageRepo struct {
+	db *sqlx.DB
+}
+
+func NewImageRepo(db *sqlx.DB) ImageRepo {
+	return ImageRepo{db: db}
+}
+
+func (r *ImageRepo) CreateUpload(ctx context.Context, tx *sql.Tx, upload Upload) error {
+	query := `
+		INSERT INTO user_uploads
+			(id, user_id, object_key, created_at)
+		VALUES
+			(:id, :user_id, :object_key, :created_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, upload)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/phone"
+	"github.com/pkg/errors"
+)
+
+const (
+	scopeCredential = "credential"
+	scopeIP         = "ip"
+)
+
+// Guard throttles password guessing with one counter per credential and one per client IP,
+// so neither a single account nor a single client can be used to brute force
+type Guard struct {
+	store            AttemptStore
+	credentialPolicy Policy
+	ipPolicy         Policy
+}
+
+func NewGuard(store AttemptStore, credentialPolicy, ipPolicy Policy) *Guard {
+	return &Guard{
+		store:            store,
+		credentialPolicy: credentialPolicy,
+		ipPolicy:         ipPolicy,
+	}
+}
+
+// CredentialKey builds the subject used to count failures for a login credential. Phones are
+// counted in E.164, so typing the number another way does not reset its counter
+func CredentialKey(credentialType, credentialValue string) string {
+	if credentialType == "phone" {
+		if number, err := phone.Normalize(credentialValue); err == nil {
+			return credentialType + ":" + number
+		}
+	}
+
+	return credentialType + ":" + strings.ToLower(strings.TrimSpace(credentialValue))
+}
+
+// Check returns how long the caller must wait before trying again. Zero means the attempt may proceed
+func (g *Guard) Check(ctx context.Context, subject, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+
+	keys := []struct {
+		scope string
+		key   string
+	}{
+		{scopeCredential, scopeCredential + ":" + subject},
+		{scopeIP, scopeIP + ":" + ip},
+	}
+
+	var retryAfter time.Duration
+	for _, k := range keys {
+		attempt, err := g.store.Get(ctx, k.key)
+		if err != nil {
+			return 0, errors.Wrap(err, "AttemptStore.Get error")
+		}
+
+		if attempt.LockedUntil.Valid && attempt.LockedUntil.Time.After(now) {
+			loginThrottled.WithLabelValues(k.scope).Inc()
+			if wait := attempt.LockedUntil.Time.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// RecordFailure counts a failed attempt for both the subject and the IP, locking them out
+// once their policy allows no more free attempts
+func (g *Guard) RecordFailure(ctx context.Context, reason, subject, ip string) error {
+	loginFailures.WithLabelValues(reason).Inc()
+
+	err := g.recordFailure(ctx, scopeCredential, scopeCredential+":"+subject, g.credentialPolicy)
+	if err != nil {
+		return err
+	}
+
+	return g.recordFailure(ctx, scopeIP, scopeIP+":"+ip, g.ipPolicy)
+}
+
+func (g *Guard) recordFailure(ctx context.Context, scope, key string, policy Policy) error {
+	now := time.Now().UTC()
+
+	attempt, err := g.store.Increment(ctx, key, now, now.Add(-policy.Window))
+	if err != nil {
+		return errors.Wrap(err, "AttemptStore.Increment error")
+	}
+
+	lockout := policy.lockoutFor(attempt.Failures)
+	if lockout == 0 {
+		return nil
+	}
+
+	err = g.store.Lock(ctx, key, now.Add(lockout))
+	if err != nil {
+		return errors.Wrap(err, "AttemptStore.Lock error")
+	}
+	loginLockouts.WithLabelValues(scope).Inc()
+
+	return nil
+}
+
+// RecordSuccess clears the subject counter. The IP counter is kept, otherwise an attacker
+// could reset it by logging in to their own account between guesses
+func (g *Guard) RecordSuccess(ctx context.Context, subject string) error {
+	err := g.store.Reset(ctx, scopeCredential+":"+subject)
+	if err != nil {
+		return errors.Wrap(err, "AttemptStore.Reset error")
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package loginguard
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	attempts  map[string]Attempt
+	maxAge    time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryStore keeps the counters in process. Entries idle for longer than maxAge are dropped
+func NewMemoryStore(maxAge time.Duration) *MemoryStore {
+	return &MemoryStore{
+		attempts:  map[string]Attempt{},
+		maxAge:    maxAge,
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, found := s.attempts[key]
+	if !found {
+		return Attempt{Key: key}, nil
+	}
+
+	return attempt, nil
+}
+
+func (s *MemoryStore) Increment(_ context.Context, key string, now, resetBefore time.Time) (Attempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, found := s.attempts[key]
+	if !found || attempt.LastFailureAt.Before(resetBefore) {
+		attempt = Attempt{Key: key, LockedUntil: attempt.LockedUntil}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	s.attempts[key] = attempt
+
+	s.sweep(now)
+
+	return attempt, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	s.attempts[key] = attempt
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+// sweep drops idle entries. Must be called with the lock held
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.maxAge {
+		return
+	}
+
+	for key, attempt := range s.attempts {
+		if now.Sub(attempt.LastFailureAt) > s.maxAge && (!attempt.LockedUntil.Valid || now.After(attempt.LockedUntil.Time)) {
+			delete(s.attempts, key)
+		}
+	}
+
+	s.lastSweep = now
+}
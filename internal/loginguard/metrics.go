@@ -0,0 +1,26 @@
+package loginguard
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	loginFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "segokuning",
+		Name:      "login_failures_total",
+		Help:      "Number of failed login attempts, by reason.",
+	}, []string{"reason"})
+
+	loginLockouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "segokuning",
+		Name:      "login_lockouts_total",
+		Help:      "Number of times a credential or an IP address got temporarily locked out.",
+	}, []string{"scope"})
+
+	loginThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "segokuning",
+		Name:      "login_throttled_total",
+		Help:      "Number of login attempts rejected because of an active lockout.",
+	}, []string{"scope"})
+)
@@ -0,0 +1,52 @@
+package loginguard
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Attempt is the failed login counter of one key (a credential or an IP address)
+type Attempt struct {
+	Key           string       `db:"key"`
+	Failures      int          `db:"failures"`
+	LastFailureAt time.Time    `db:"last_failure_at"`
+	LockedUntil   sql.NullTime `db:"locked_until"`
+}
+
+// AttemptStore persists failed login counters. MemoryStore is enough for a single instance,
+// PostgresStore shares the counters between instances
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (Attempt, error)
+	// Increment adds a failure to key. The count restarts from 1 when the previous
+	// failure happened before resetBefore
+	Increment(ctx context.Context, key string, now, resetBefore time.Time) (Attempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides when a key gets locked and for how long. The first FreeAttempts failures
+// are free, every failure after that doubles the lockout, starting at BaseLockout
+type Policy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	// Window is how long a failure is remembered when no other failure follows
+	Window time.Duration
+}
+
+func (p Policy) lockoutFor(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	lockout := p.BaseLockout
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+
+	return lockout
+}
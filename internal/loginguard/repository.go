@@ -0,0 +1,111 @@
+package loginguard
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore shares the login attempt counters between app instances
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (r *PostgresStore) Get(ctx context.Context, key string) (Attempt, error) {
+	var result Attempt
+
+	query := `
+		SELECT
+			key,
+			failures,
+			last_failure_at,
+			locked_until
+		FROM
+			login_attempts
+		WHERE
+			key = $1
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Attempt{Key: key}, nil
+		}
+
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *PostgresStore) Increment(ctx context.Context, key string, now, resetBefore time.Time) (Attempt, error) {
+	var result Attempt
+
+	// single statement so concurrent failures on other instances are all counted
+	query := `
+		INSERT INTO login_attempts
+			(key, failures, last_failure_at)
+		VALUES
+			($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < $3 THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING
+			key,
+			failures,
+			last_failure_at,
+			locked_until
+	`
+
+	err := r.db.GetContext(ctx, &result, query, key, now, resetBefore)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `
+		UPDATE
+			login_attempts
+		SET
+			locked_until = $2
+		WHERE
+			key = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, key, until)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *PostgresStore) Reset(ctx context.Context, key string) error {
+	query := `
+		DELETE FROM
+			login_attempts
+		WHERE
+			key = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
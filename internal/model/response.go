@@ -1,5 +1,7 @@
 package model
 
+import "github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+
 type ResponseMeta struct {
 	Limit  uint `json:"limit"`
 	Offset uint `json:"offset"`
@@ -13,5 +15,8 @@ type DataResponse struct {
 }
 
 type ErrorResponse struct {
+	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Errors lists the rejected fields when Code is "validation_failed"
+	Errors validation.Errors `json:"errors,omitempty"`
 }
@@ -0,0 +1,73 @@
+package personaltoken
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/token"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// Authenticator resolves personal access tokens for the JWT middleware
+type Authenticator struct {
+	tokenRepo *PersonalTokenRepo
+}
+
+func NewAuthenticator(tokenRepo *PersonalTokenRepo) *Authenticator {
+	return &Authenticator{tokenRepo: tokenRepo}
+}
+
+func (a *Authenticator) AuthenticatePersonalToken(ctx context.Context, rawToken string) (jwt.JWTUser, error) {
+	owner, err := a.tokenRepo.GetTokenByHash(ctx, token.Hash(rawToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return jwt.JWTUser{}, jwt.ErrInvalidToken
+		}
+		return jwt.JWTUser{}, errors.Wrap(err, "GetTokenByHash error")
+	}
+
+	now := time.Now().UTC()
+	if owner.RevokedAt.Valid || !owner.ExpiresAt.After(now) {
+		return jwt.JWTUser{}, jwt.ErrInvalidToken
+	}
+
+	// tokens must not keep working for an account its owner cannot log in to.
+	// Using a token does not cancel a scheduled deletion, only logging in does
+	if owner.BannedAt.Valid {
+		return jwt.JWTUser{}, config.ErrAccountBanned
+	}
+	if owner.SuspendedUntil.Valid && owner.SuspendedUntil.Time.After(now) {
+		return jwt.JWTUser{}, fiber.NewError(
+			http.StatusForbidden,
+			fmt.Sprintf("account is suspended until %s", owner.SuspendedUntil.Time.Format(time.RFC3339)),
+		)
+	}
+	if owner.DeletionScheduledAt.Valid {
+		return jwt.JWTUser{}, jwt.ErrInvalidToken
+	}
+
+	if !owner.LastUsedAt.Valid || now.Sub(owner.LastUsedAt.Time) >= lastUsedGranularity {
+		if err := a.tokenRepo.UpdateLastUsed(ctx, owner.ID, now); err != nil {
+			log.Println("failed to update personal access token last use: ", err)
+		}
+	}
+
+	return jwt.JWTUser{
+		UserID:    owner.UserID,
+		Name:      owner.UserName,
+		Email:     owner.Email.String,
+		Phone:     owner.Phone.String,
+		Scopes:    owner.Scopes,
+		TokenType: jwt.TokenTypePersonal,
+		TokenID:   owner.ID,
+		IssuedAt:  owner.CreatedAt,
+		ExpiresAt: owner.ExpiresAt,
+	}, nil
+}
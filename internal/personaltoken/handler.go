@@ -0,0 +1,175 @@
+package personaltoken
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/token"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type personalTokenHandler struct {
+	tokenRepo     *PersonalTokenRepo
+	auditRecorder *audit.Recorder
+}
+
+type PersonalTokenHandlerConfig struct {
+	TokenRepo     *PersonalTokenRepo
+	AuditRecorder *audit.Recorder
+}
+
+func NewPersonalTokenHandler(cfg PersonalTokenHandlerConfig) personalTokenHandler {
+	return personalTokenHandler{
+		tokenRepo:     cfg.TokenRepo,
+		auditRecorder: cfg.AuditRecorder,
+	}
+}
+
+func (h *personalTokenHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
+	// no scopes: a personal access token cannot be used to mint or revoke tokens
+	authMiddleware := jwtProvider.Middleware()
+
+	r.Get("/v1/user/tokens", authMiddleware, h.ListTokens)
+	r.Post("/v1/user/tokens", authMiddleware, h.CreateToken)
+	r.Delete("/v1/user/tokens/:tokenId<guid>", authMiddleware, h.RevokeToken)
+}
+
+func (h *personalTokenHandler) CreateToken(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	var payload CreateTokenRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+	payload.UserID = claims.UserID
+
+	ctx := c.Context()
+	response, err := h.createToken(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventPersonalTokenCreated, claims.UserID, audit.Details{
+		"tokenId": response.ID,
+		"name":    response.Name,
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(model.DataResponse{
+		Message: "token created successfully, copy it now as it will not be shown again",
+		Data:    response,
+	})
+}
+
+func (h *personalTokenHandler) createToken(ctx context.Context, payload CreateTokenRequest) (PersonalTokenResponse, error) {
+	now := time.Now().UTC()
+
+	count, err := h.tokenRepo.CountActiveTokens(ctx, payload.UserID, now)
+	if err != nil {
+		return PersonalTokenResponse{}, errors.Wrap(err, "CountActiveTokens error")
+	}
+	if count >= MaxActiveTokens {
+		return PersonalTokenResponse{}, config.ErrPersonalTokenLimit
+	}
+
+	secret, err := token.Generate(32)
+	if err != nil {
+		return PersonalTokenResponse{}, err
+	}
+	rawToken := jwt.PersonalTokenPrefix + secret
+
+	personalToken := PersonalToken{
+		ID:          uuid.NewString(),
+		UserID:      payload.UserID,
+		Name:        payload.Name,
+		TokenHash:   token.Hash(rawToken),
+		TokenPrefix: rawToken[:len(jwt.PersonalTokenPrefix)+4],
+		Scopes:      uniqueScopes(payload.Scopes),
+		ExpiresAt:   now.AddDate(0, 0, payload.ExpiresInDays),
+		CreatedAt:   now,
+	}
+
+	err = h.tokenRepo.CreateToken(ctx, nil, personalToken)
+	if err != nil {
+		return PersonalTokenResponse{}, errors.Wrap(err, "CreateToken error")
+	}
+
+	response := newPersonalTokenResponse(personalToken)
+	response.Token = rawToken
+
+	return response, nil
+}
+
+func uniqueScopes(scopes []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+
+	return result
+}
+
+func (h *personalTokenHandler) ListTokens(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	tokens, err := h.tokenRepo.ListUserTokens(c.Context(), claims.UserID)
+	if err != nil {
+		return errors.Wrap(err, "ListUserTokens error")
+	}
+
+	responses := []PersonalTokenResponse{}
+	for _, personalToken := range tokens {
+		responses = append(responses, newPersonalTokenResponse(personalToken))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    responses,
+	})
+}
+
+func (h *personalTokenHandler) RevokeToken(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	ctx := c.Context()
+	tokenID := c.Params("tokenId")
+	err = h.tokenRepo.RevokeToken(ctx, nil, claims.UserID, tokenID, time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrPersonalTokenNotFound
+		}
+		return errors.Wrap(err, "RevokeToken error")
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventPersonalTokenRevoked, claims.UserID, audit.Details{
+		"tokenId": tokenID,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "token revoked successfully",
+	})
+}
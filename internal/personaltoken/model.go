@@ -0,0 +1,60 @@
+package personaltoken
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// scopes a personal access token can be given. Routes accepting personal access tokens
+// pass the scopes they need to the JWT middleware
+const (
+	ScopePostRead    = "post:read"
+	ScopePostWrite   = "post:write"
+	ScopeFriendRead  = "friend:read"
+	ScopeFriendWrite = "friend:write"
+	ScopeProfileRead = "profile:read"
+	ScopeImageWrite  = "image:write"
+)
+
+const (
+	// MaxActiveTokens is how many unrevoked tokens a user can have at once
+	MaxActiveTokens = 20
+	// lastUsedGranularity spares a write on every request made with the same token
+	lastUsedGranularity = time.Minute
+)
+
+type CreateTokenRequest struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=post:read post:write friend:read friend:write profile:read image:write"`
+	// ExpiresInDays is required, tokens never live forever
+	ExpiresInDays int `json:"expiresInDays" validate:"required,min=1,max=365"`
+
+	UserID string
+}
+
+type PersonalToken struct {
+	ID          string         `db:"id"`
+	UserID      string         `db:"user_id"`
+	Name        string         `db:"name"`
+	TokenHash   string         `db:"token_hash"`
+	TokenPrefix string         `db:"token_prefix"`
+	Scopes      pq.StringArray `db:"scopes"`
+	ExpiresAt   time.Time      `db:"expires_at"`
+	LastUsedAt  sql.NullTime   `db:"last_used_at"`
+	RevokedAt   sql.NullTime   `db:"revoked_at"`
+	CreatedAt   time.Time      `db:"created_at"`
+}
+
+// TokenOwner is a token along with the user fields needed to authenticate a request with it
+type TokenOwner struct {
+	PersonalToken
+
+	UserName            string         `db:"user_name"`
+	Email               sql.NullString `db:"email"`
+	Phone               sql.NullString `db:"phone"`
+	DeletionScheduledAt sql.NullTime   `db:"deletion_scheduled_at"`
+	SuspendedUntil      sql.NullTime   `db:"suspended_until"`
+	BannedAt            sql.NullTime   `db:"banned_at"`
+}
@@ -0,0 +1,189 @@
+package personaltoken
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type PersonalTokenRepo struct {
+	db *sqlx.DB
+}
+
+func NewPersonalTokenRepo(db *sqlx.DB) PersonalTokenRepo {
+	return PersonalTokenRepo{db: db}
+}
+
+func (r *PersonalTokenRepo) CreateToken(ctx context.Context, tx *sql.Tx, personalToken PersonalToken) error {
+	query := `
+		INSERT INTO personal_access_tokens
+			(id, user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES
+			(:id, :user_id, :name, :token_hash, :token_prefix, :scopes, :expires_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, personalToken)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListUserTokens returns the unrevoked tokens of the user, expired ones included, newest first
+func (r *PersonalTokenRepo) ListUserTokens(ctx context.Context, userID string) ([]PersonalToken, error) {
+	tokens := []PersonalToken{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			name,
+			token_hash,
+			token_prefix,
+			scopes,
+			expires_at,
+			last_used_at,
+			revoked_at,
+			created_at
+		FROM
+			personal_access_tokens
+		WHERE
+			user_id = $1
+			AND revoked_at IS NULL
+		ORDER BY
+			created_at DESC
+	`
+
+	err := r.db.SelectContext(ctx, &tokens, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// CountActiveTokens counts the unrevoked and unexpired tokens of the user
+func (r *PersonalTokenRepo) CountActiveTokens(ctx context.Context, userID string, now time.Time) (int, error) {
+	var count int
+
+	query := `
+		SELECT
+			COUNT(*)
+		FROM
+			personal_access_tokens
+		WHERE
+			user_id = $1
+			AND revoked_at IS NULL
+			AND expires_at > $2
+	`
+
+	err := r.db.GetContext(ctx, &count, query, userID, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *PersonalTokenRepo) GetTokenByHash(ctx context.Context, tokenHash string) (TokenOwner, error) {
+	var result TokenOwner
+
+	query := `
+		SELECT
+			t.id,
+			t.user_id,
+			t.name,
+			t.token_hash,
+			t.token_prefix,
+			t.scopes,
+			t.expires_at,
+			t.last_used_at,
+			t.revoked_at,
+			t.created_at,
+			u.name AS user_name,
+			u.email,
+			u.phone,
+			u.deletion_scheduled_at,
+			u.suspended_until,
+			u.banned_at
+		FROM
+			personal_access_tokens t
+			JOIN users u ON u.id = t.user_id
+		WHERE
+			t.token_hash = $1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, tokenHash)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// RevokeToken revokes a token of the user. Returns sql.ErrNoRows when the user has no such unrevoked token
+func (r *PersonalTokenRepo) RevokeToken(ctx context.Context, tx *sql.Tx, userID, tokenID string, revokedAt time.Time) error {
+	query := `
+		UPDATE
+			personal_access_tokens
+		SET
+			revoked_at = $3
+		WHERE
+			id = $1
+			AND user_id = $2
+			AND revoked_at IS NULL
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, tokenID, userID, revokedAt)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, tokenID, userID, revokedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *PersonalTokenRepo) UpdateLastUsed(ctx context.Context, tokenID string, usedAt time.Time) error {
+	query := `
+		UPDATE
+			personal_access_tokens
+		SET
+			last_used_at = $2
+		WHERE
+			id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, tokenID, usedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package personaltoken
+
+import "time"
+
+type PersonalTokenResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Token is only returned when the token is created, it cannot be retrieved afterwards
+	Token      string     `json:"token,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func newPersonalTokenResponse(personalToken PersonalToken) PersonalTokenResponse {
+	resp := PersonalTokenResponse{
+		ID:        personalToken.ID,
+		Name:      personalToken.Name,
+		Prefix:    personalToken.TokenPrefix,
+		Scopes:    personalToken.Scopes,
+		ExpiresAt: personalToken.ExpiresAt,
+		CreatedAt: personalToken.CreatedAt,
+	}
+	if personalToken.LastUsedAt.Valid {
+		resp.LastUsedAt = &personalToken.LastUsedAt.Time
+	}
+
+	return resp
+}
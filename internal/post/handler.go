@@ -10,6 +10,9 @@ import (
 	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/friend"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/personaltoken"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/privacy"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/handle"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
 	"github.com/gofiber/fiber/v2"
@@ -18,33 +21,37 @@ import (
 )
 
 type postHandler struct {
-	postRepo   *PostRepo
-	txProvider *config.TransactionProvider
-	friendRepo *friend.FriendRepo
+	postRepo    *PostRepo
+	txProvider  *config.TransactionProvider
+	friendRepo  *friend.FriendRepo
+	privacyRepo *privacy.PrivacyRepo
 }
 
 type PostHandlerConfig struct {
-	PostRepo   *PostRepo
-	TxProvider *config.TransactionProvider
-	FriendRepo *friend.FriendRepo
+	PostRepo    *PostRepo
+	TxProvider  *config.TransactionProvider
+	FriendRepo  *friend.FriendRepo
+	PrivacyRepo *privacy.PrivacyRepo
 }
 
 func NewPostHandler(cfg PostHandlerConfig) postHandler {
 	return postHandler{
-		postRepo:   cfg.PostRepo,
-		txProvider: cfg.TxProvider,
-		friendRepo: cfg.FriendRepo,
+		postRepo:    cfg.PostRepo,
+		txProvider:  cfg.TxProvider,
+		friendRepo:  cfg.FriendRepo,
+		privacyRepo: cfg.PrivacyRepo,
 	}
 }
 
 func (h *postHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
 	group := r.Group("/v1/post")
-	authMiddleware := jwtProvider.Middleware()
-	group.Use(authMiddleware)
+	// personal access tokens are accepted with the matching scope
+	readMiddleware := jwtProvider.Middleware(personaltoken.ScopePostRead)
+	writeMiddleware := jwtProvider.Middleware(personaltoken.ScopePostWrite)
 
-	group.Get("/", h.ListPosts)
-	group.Post("/", h.CreatePost)
-	group.Post("/comment", h.AddComment)
+	group.Get("/", readMiddleware, h.ListPosts)
+	group.Post("/", writeMiddleware, h.CreatePost)
+	group.Post("/comment", writeMiddleware, h.AddComment)
 }
 
 func (h *postHandler) ListPosts(c *fiber.Ctx) error {
@@ -60,7 +67,7 @@ func (h *postHandler) ListPosts(c *fiber.Ctx) error {
 	}
 	payload.Queries = c.Queries()
 	if err := payload.Validate(); err != nil {
-		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+		return err
 	}
 
 	postResponses, meta, err := h.getPosts(c.Context(), payload)
@@ -104,7 +111,7 @@ func (h *postHandler) getPosts(ctx context.Context, payload ListPostsRequest) ([
 		wg.Add(2)
 		go func() {
 			defer wg.Done()
-			commentsMap, getCommentErr = h.postRepo.BulkGetPostComments(ctx, postIDs)
+			commentsMap, getCommentErr = h.postRepo.BulkGetPostComments(ctx, payload.UserID, postIDs)
 		}()
 		go func() {
 			defer wg.Done()
@@ -128,13 +135,7 @@ func (h *postHandler) getPosts(ctx context.Context, payload ListPostsRequest) ([
 		for _, v := range postCommentDetails {
 			comments = append(comments, CommentResponse{
 				Comment: v.Comment,
-				Creator: UserCreatorResponse{
-					UserID:      v.UserID,
-					Name:        v.Name,
-					ImageURL:    v.ImageURL.String,
-					FriendCount: v.FriendCount,
-					CreatedAt:   v.UserCreatedAt,
-				},
+				Creator: buildCreatorResponse(v.UserInPost),
 			})
 		}
 
@@ -146,13 +147,7 @@ func (h *postHandler) getPosts(ctx context.Context, payload ListPostsRequest) ([
 				CreatedAt:  post.PostCreatedAt,
 			},
 			Comments: comments,
-			Creator: UserCreatorResponse{
-				UserID:      post.UserID,
-				Name:        post.Name,
-				ImageURL:    post.ImageURL.String,
-				FriendCount: post.FriendCount,
-				CreatedAt:   post.UserCreatedAt,
-			},
+			Creator:  buildCreatorResponse(post.UserInPost),
 		})
 	}
 
@@ -163,6 +158,23 @@ func (h *postHandler) getPosts(ctx context.Context, payload ListPostsRequest) ([
 	return postResponses, responseMeta, nil
 }
 
+func buildCreatorResponse(u UserInPost) UserCreatorResponse {
+	response := UserCreatorResponse{
+		UserID:    u.UserID,
+		Name:      u.Name,
+		Username:  u.Username.String,
+		ImageURL:  u.ImageURL.String,
+		Bio:       u.Bio.String,
+		CreatedAt: u.UserCreatedAt,
+	}
+	if u.FriendCount.Valid {
+		friendCount := int(u.FriendCount.Int64)
+		response.FriendCount = &friendCount
+	}
+
+	return response
+}
+
 func (h *postHandler) CreatePost(c *fiber.Ctx) error {
 	var payload CreatePostRequest
 	claims, err := jwt.GetLoggedInUser(c)
@@ -176,7 +188,7 @@ func (h *postHandler) CreatePost(c *fiber.Ctx) error {
 	}
 
 	if err := validation.Validate(payload); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		return err
 	}
 
 	post, err := h.createPostAndTags(c.Context(), payload)
@@ -193,6 +205,7 @@ func (h *postHandler) CreatePost(c *fiber.Ctx) error {
 				Tags:       payload.Tags,
 				CreatedAt:  post.CreatedAt,
 			},
+			Mentions: toMentionResponses(post.Mentions),
 		},
 	})
 }
@@ -231,6 +244,18 @@ func (h *postHandler) createPostAndTags(ctx context.Context, payload CreatePostR
 		return post, errors.Wrap(err, "CreatePost error")
 	}
 
+	// mentions are resolved from the raw text, before it is escaped
+	post.Mentions, err = h.resolveMentions(ctx, payload.PostInHTML, postID, "")
+	if err != nil {
+		return post, err
+	}
+	if len(post.Mentions) > 0 {
+		err = h.postRepo.CreateMentions(ctx, tx, post.Mentions)
+		if err != nil {
+			return post, errors.Wrap(err, "CreateMentions error")
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return post, errors.Wrap(err, "commit error")
@@ -252,7 +277,7 @@ func (h *postHandler) AddComment(c *fiber.Ctx) error {
 	}
 
 	if err := validation.Validate(payload); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		return err
 	}
 
 	ctx := c.Context()
@@ -273,7 +298,13 @@ func (h *postHandler) AddComment(c *fiber.Ctx) error {
 		if err != nil {
 			return errors.Wrap(err, "IsUserFriendWith error")
 		}
-		if !isFriend {
+
+		// the post creator decides whether only their friends can comment
+		settings, err := h.privacyRepo.GetSettings(ctx, post.UserID)
+		if err != nil {
+			return errors.Wrap(err, "GetSettings error")
+		}
+		if !settings.CommentAllowedFrom(isFriend) {
 			return config.ErrPostCreatorIsNotFriend
 		}
 	}
@@ -285,9 +316,14 @@ func (h *postHandler) AddComment(c *fiber.Ctx) error {
 		PostID:  payload.PostID,
 		Comment: payload.Comment,
 	}
-	err = h.postRepo.CreateComment(ctx, nil, postComment)
+	mentions, err := h.resolveMentions(ctx, payload.Comment, postComment.PostID, postComment.ID)
 	if err != nil {
-		return errors.Wrap(err, "CreateComment error")
+		return err
+	}
+
+	err = h.createCommentAndMentions(ctx, postComment, mentions)
+	if err != nil {
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
@@ -296,6 +332,78 @@ func (h *postHandler) AddComment(c *fiber.Ctx) error {
 			PostID:    postComment.PostID,
 			CommentID: postComment.ID,
 			Comment:   postComment.Comment,
+			Mentions:  toMentionResponses(mentions),
 		},
 	})
 }
+
+func (h *postHandler) createCommentAndMentions(ctx context.Context, comment PostComment, mentions []PostMention) error {
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.postRepo.CreateComment(ctx, tx, comment)
+	if err != nil {
+		return errors.Wrap(err, "CreateComment error")
+	}
+
+	if len(mentions) > 0 {
+		err = h.postRepo.CreateMentions(ctx, tx, mentions)
+		if err != nil {
+			return errors.Wrap(err, "CreateMentions error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit error")
+	}
+
+	return nil
+}
+
+// resolveMentions finds the @handles in text which belong to an existing user.
+// commentID is empty when text is the post itself
+func (h *postHandler) resolveMentions(ctx context.Context, text, postID, commentID string) ([]PostMention, error) {
+	mentions := []PostMention{}
+
+	handles := handle.ExtractMentions(text)
+	if len(handles) == 0 {
+		return mentions, nil
+	}
+
+	handleToUserID, err := h.postRepo.ResolveHandles(ctx, handles)
+	if err != nil {
+		return nil, errors.Wrap(err, "ResolveHandles error")
+	}
+
+	for _, hd := range handles {
+		userID, ok := handleToUserID[hd]
+		if !ok {
+			continue
+		}
+
+		mentions = append(mentions, PostMention{
+			PostID:    postID,
+			CommentID: sql.NullString{String: commentID, Valid: commentID != ""},
+			UserID:    userID,
+			Handle:    hd,
+		})
+	}
+
+	return mentions, nil
+}
+
+func toMentionResponses(mentions []PostMention) []MentionResponse {
+	responses := []MentionResponse{}
+	for _, m := range mentions {
+		responses = append(responses, MentionResponse{
+			UserID: m.UserID,
+			Handle: m.Handle,
+		})
+	}
+
+	return responses
+}
@@ -2,8 +2,9 @@ package post
 
 import (
 	"database/sql"
-	"errors"
 	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
 )
 
 type CreatePostRequest struct {
@@ -26,17 +27,18 @@ type ListPostsRequest struct {
 
 // Validate is a function for additional validation related to query
 func (r *ListPostsRequest) Validate() error {
+	var validationErrs validation.Errors
 	queries := r.Queries
 
 	if val, ok := queries["limit"]; ok && val == "" {
-		return errors.New("limit is empty")
+		validationErrs.Add("limit", "required", "is empty")
 	}
 
 	if val, ok := queries["offset"]; ok && val == "" {
-		return errors.New("offset is empty")
+		validationErrs.Add("offset", "required", "is empty")
 	}
 
-	return nil
+	return validationErrs.Err()
 }
 
 type AddCommentRequest struct {
@@ -52,14 +54,16 @@ type Post struct {
 	PostInHTML string    `db:"post_in_html"`
 	CreatedAt  time.Time `db:"created_at"`
 
-	Tags []PostTag
+	Tags     []PostTag
+	Mentions []PostMention
 }
 
 type PostComment struct {
-	ID      string `db:"id"`
-	UserID  string `db:"user_id"`
-	PostID  string `db:"post_id"`
-	Comment string `db:"comment"`
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	PostID    string    `db:"post_id"`
+	Comment   string    `db:"comment"`
+	CreatedAt time.Time `db:"created_at"`
 }
 
 type PostTag struct {
@@ -68,11 +72,23 @@ type PostTag struct {
 	Tag    string `db:"tag"`
 }
 
+type PostMention struct {
+	ID        int            `db:"id"`
+	PostID    string         `db:"post_id"`
+	CommentID sql.NullString `db:"comment_id"`
+	UserID    string         `db:"user_id"`
+	// Handle is the mention as written, lowercased
+	Handle string `db:"-"`
+}
+
+// UserInPost has a null FriendCount when the user hides their friend list from the querying user
 type UserInPost struct {
 	UserID        string         `db:"user_id"`
 	Name          string         `db:"name"`
+	Username      sql.NullString `db:"username"`
 	ImageURL      sql.NullString `db:"image_url"`
-	FriendCount   int            `db:"friend_count"`
+	FriendCount   sql.NullInt64  `db:"friend_count"`
+	Bio           sql.NullString `db:"bio"`
 	UserCreatedAt time.Time      `db:"user_created_at"`
 }
 
@@ -83,17 +83,30 @@ func (r *PostRepo) GetPosts(ctx context.Context, req ListPostsRequest) ([]PostDe
 			-- user fields
 			p.user_id AS user_id,
 			u.name AS name,
+			u.username AS username,
 			u.image_url AS image_url,
-			u.friend_count AS friend_count,
+			-- the friend count is part of the friend list, it is hidden the same way
+			CASE
+				WHEN u.id = ? THEN u.friend_count
+				WHEN COALESCE(ps.friend_list_visibility, 'everyone') = 'everyone' THEN u.friend_count
+				WHEN ps.friend_list_visibility = 'friends' AND uf.user_id_2 IS NOT NULL THEN u.friend_count
+			END AS friend_count,
+			u.bio AS bio,
 			u.created_at AS user_created_at
 		FROM
 			posts p
 			INNER JOIN users u
 			ON p.user_id = u.id
+			LEFT JOIN user_privacy_settings ps
+			ON ps.user_id = u.id
+			LEFT JOIN user_friends uf
+			ON uf.user_id_1 = ? AND uf.user_id_2 = u.id AND uf.status = 'confirmed'
 			INNER JOIN post_tags pt
 			ON p.id = pt.post_id
 		WHERE
-			(
+			-- posts of banned users are hidden, not deleted, so a lifted ban brings them back
+			u.banned_at IS NULL
+			AND (
 				p.user_id = ?
 				OR p.user_id = ANY(
 					SELECT
@@ -102,12 +115,13 @@ func (r *PostRepo) GetPosts(ctx context.Context, req ListPostsRequest) ([]PostDe
 						user_friends
 					WHERE
 						user_id_1 = ?
+						AND status = 'confirmed'
 				)
 			)
 		%s
 	`
 
-	args := []interface{}{req.UserID, req.UserID}
+	args := []interface{}{req.UserID, req.UserID, req.UserID, req.UserID}
 
 	filterQuery, filterArgs := getFilter(req)
 
@@ -180,7 +194,8 @@ func getLimitAndOffset(req ListPostsRequest) (string, []interface{}) {
 	return query, args
 }
 
-func (r *PostRepo) BulkGetPostComments(ctx context.Context, postIDs []string) (map[string][]CommentDetail, error) {
+// BulkGetPostComments returns the comments of the posts, with their authors as seen by viewerID
+func (r *PostRepo) BulkGetPostComments(ctx context.Context, viewerID string, postIDs []string) (map[string][]CommentDetail, error) {
 	var details []CommentDetail
 
 	baseQuery := `
@@ -191,20 +206,32 @@ func (r *PostRepo) BulkGetPostComments(ctx context.Context, postIDs []string) (m
 			-- user fields
 			pc.user_id AS user_id,
 			u.name AS name,
+			u.username AS username,
 			u.image_url AS image_url,
-			u.friend_count AS friend_count,
+			-- the friend count is part of the friend list, it is hidden the same way
+			CASE
+				WHEN u.id = ? THEN u.friend_count
+				WHEN COALESCE(ps.friend_list_visibility, 'everyone') = 'everyone' THEN u.friend_count
+				WHEN ps.friend_list_visibility = 'friends' AND uf.user_id_2 IS NOT NULL THEN u.friend_count
+			END AS friend_count,
+			u.bio AS bio,
 			u.created_at AS user_created_at
 		FROM
 			post_comments pc
 			INNER JOIN users u
 			ON pc.user_id = u.id
+			LEFT JOIN user_privacy_settings ps
+			ON ps.user_id = u.id
+			LEFT JOIN user_friends uf
+			ON uf.user_id_1 = ? AND uf.user_id_2 = u.id AND uf.status = 'confirmed'
 		WHERE
-			post_id IN (?)
+			pc.post_id IN (?)
+			AND u.banned_at IS NULL
 		ORDER BY
 			pc.created_at DESC
 	`
 
-	updatedQuery, args, err := sqlx.In(baseQuery, postIDs)
+	updatedQuery, args, err := sqlx.In(baseQuery, viewerID, viewerID, postIDs)
 	if err != nil {
 		return nil, err
 	}
@@ -259,6 +286,59 @@ func (r *PostRepo) BulkGetPostTags(ctx context.Context, postIDs []string) (map[s
 	return postToTagMap, nil
 }
 
+// ListPostsByUser returns every post written by the user, newest first
+func (r *PostRepo) ListPostsByUser(ctx context.Context, userID string) ([]Post, error) {
+	posts := []Post{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			post_in_html,
+			created_at
+		FROM
+			posts
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at DESC
+	`
+
+	err := r.db.SelectContext(ctx, &posts, query, userID)
+	if err != nil {
+		return posts, err
+	}
+
+	return posts, nil
+}
+
+// ListCommentsByUser returns every comment written by the user, newest first
+func (r *PostRepo) ListCommentsByUser(ctx context.Context, userID string) ([]PostComment, error) {
+	comments := []PostComment{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			post_id,
+			comment,
+			created_at
+		FROM
+			post_comments
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at DESC
+	`
+
+	err := r.db.SelectContext(ctx, &comments, query, userID)
+	if err != nil {
+		return comments, err
+	}
+
+	return comments, nil
+}
+
 func (r *PostRepo) GetPostByID(ctx context.Context, postID string) (Post, error) {
 	var post Post
 
@@ -309,3 +389,66 @@ func (r *PostRepo) CreateComment(ctx context.Context, tx *sql.Tx, comment PostCo
 
 	return nil
 }
+
+// ResolveHandles maps each of the given lowercased handles to the ID of its owner. Unknown handles are left out
+func (r *PostRepo) ResolveHandles(ctx context.Context, handles []string) (map[string]string, error) {
+	var users []struct {
+		UserID   string `db:"id"`
+		Username string `db:"username"`
+	}
+
+	baseQuery := `
+		SELECT
+			id,
+			LOWER(username) AS username
+		FROM
+			users
+		WHERE
+			LOWER(username) IN (?)
+			AND deletion_scheduled_at IS NULL
+	`
+
+	updatedQuery, args, err := sqlx.In(baseQuery, handles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &users, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	handleToUserID := map[string]string{}
+	for _, u := range users {
+		handleToUserID[u.Username] = u.UserID
+	}
+
+	return handleToUserID, nil
+}
+
+func (r *PostRepo) CreateMentions(ctx context.Context, tx *sql.Tx, mentions []PostMention) error {
+	query := `
+		INSERT INTO
+			post_mentions
+			(post_id, comment_id, user_id)
+		VALUES
+			(:post_id, :comment_id, :user_id)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, mentions)
+	if err != nil {
+		return err
+	}
+
+	// since we won't be using the returned data, leave it blank
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -4,7 +4,13 @@ import "time"
 
 type CreatePostResponse struct {
 	PostOnlyResponse
-	PostID string `json:"postId"`
+	PostID   string            `json:"postId"`
+	Mentions []MentionResponse `json:"mentions"`
+}
+
+type MentionResponse struct {
+	UserID string `json:"userId"`
+	Handle string `json:"handle"`
 }
 
 type PostOnlyResponse struct {
@@ -13,11 +19,14 @@ type PostOnlyResponse struct {
 	CreatedAt  time.Time `json:"createdAt"`
 }
 
+// UserCreatorResponse has a null friendCount when the user hides their friend list from the viewer
 type UserCreatorResponse struct {
 	UserID      string    `json:"userId"`
 	Name        string    `json:"name"`
+	Username    string    `json:"username"`
 	ImageURL    string    `json:"imageUrl"`
-	FriendCount int       `json:"friendCount"`
+	FriendCount *int      `json:"friendCount"`
+	Bio         string    `json:"bio"`
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
@@ -34,7 +43,8 @@ type PostDetailResponse struct {
 }
 
 type AddCommentResponse struct {
-	PostID    string `json:"postId"`
-	CommentID string `json:"commentId"`
-	Comment   string `json:"comment"`
+	PostID    string            `json:"postId"`
+	CommentID string            `json:"commentId"`
+	Comment   string            `json:"comment"`
+	Mentions  []MentionResponse `json:"mentions"`
 }
@@ -0,0 +1,117 @@
+package privacy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+type privacyHandler struct {
+	privacyRepo   *PrivacyRepo
+	auditRecorder *audit.Recorder
+}
+
+type PrivacyHandlerConfig struct {
+	PrivacyRepo   *PrivacyRepo
+	AuditRecorder *audit.Recorder
+}
+
+func NewPrivacyHandler(cfg PrivacyHandlerConfig) privacyHandler {
+	return privacyHandler{
+		privacyRepo:   cfg.PrivacyRepo,
+		auditRecorder: cfg.AuditRecorder,
+	}
+}
+
+func (h *privacyHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
+	// no scopes: privacy settings are only managed from a signed in session
+	authMiddleware := jwtProvider.Middleware()
+
+	r.Get("/v1/user/privacy", authMiddleware, h.GetSettings)
+	r.Patch("/v1/user/privacy", authMiddleware, h.UpdateSettings)
+}
+
+func (h *privacyHandler) GetSettings(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	settings, err := h.privacyRepo.GetSettings(c.Context(), claims.UserID)
+	if err != nil {
+		return errors.Wrap(err, "GetSettings error")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    newSettingsResponse(settings),
+	})
+}
+
+func (h *privacyHandler) UpdateSettings(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	var payload UpdateSettingsRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+	if len(payload.PresentFields()) == 0 {
+		return validation.Errors{{Field: "body", Rule: "required", Message: "at least one field is required"}}
+	}
+	payload.UserID = claims.UserID
+
+	ctx := c.Context()
+	settings, err := h.updateSettings(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventPrivacyUpdated, claims.UserID, audit.Details{
+		"fields": strings.Join(payload.PresentFields(), ","),
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "privacy settings updated successfully",
+		Data:    newSettingsResponse(settings),
+	})
+}
+
+func (h *privacyHandler) updateSettings(ctx context.Context, payload UpdateSettingsRequest) (Settings, error) {
+	settings, err := h.privacyRepo.GetSettings(ctx, payload.UserID)
+	if err != nil {
+		return settings, errors.Wrap(err, "GetSettings error")
+	}
+
+	if payload.Discoverable != nil {
+		settings.Discoverable = *payload.Discoverable
+	}
+	if payload.FriendListVisibility != nil {
+		settings.FriendListVisibility = *payload.FriendListVisibility
+	}
+	if payload.CommentPermission != nil {
+		settings.CommentPermission = *payload.CommentPermission
+	}
+	settings.UpdatedAt = time.Now().UTC()
+
+	err = h.privacyRepo.SaveSettings(ctx, nil, settings)
+	if err != nil {
+		return settings, errors.Wrap(err, "SaveSettings error")
+	}
+
+	return settings, nil
+}
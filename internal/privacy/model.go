@@ -0,0 +1,77 @@
+package privacy
+
+import "time"
+
+// who can see a user's friend list and friend count
+const (
+	FriendListEveryone = "everyone"
+	FriendListFriends  = "friends"
+	FriendListOnlyMe   = "only_me"
+)
+
+// who can comment on a user's posts
+const (
+	CommentEveryone = "everyone"
+	CommentFriends  = "friends"
+)
+
+type UpdateSettingsRequest struct {
+	Discoverable         *bool   `json:"discoverable"`
+	FriendListVisibility *string `json:"friendListVisibility" validate:"omitnil,oneof=everyone friends only_me"`
+	CommentPermission    *string `json:"commentPermission" validate:"omitnil,oneof=everyone friends"`
+
+	UserID string
+}
+
+type Settings struct {
+	UserID string `db:"user_id"`
+	// Discoverable users are listed in the user search for everyone, the others only for their friends
+	Discoverable         bool      `db:"discoverable"`
+	FriendListVisibility string    `db:"friend_list_visibility"`
+	CommentPermission    string    `db:"comment_permission"`
+	UpdatedAt            time.Time `db:"updated_at"`
+}
+
+// DefaultSettings are the settings of users who never changed them, they match
+// how the app behaved before privacy settings existed
+func DefaultSettings(userID string) Settings {
+	return Settings{
+		UserID:               userID,
+		Discoverable:         true,
+		FriendListVisibility: FriendListEveryone,
+		CommentPermission:    CommentFriends,
+	}
+}
+
+// FriendListVisibleTo reports whether a viewer other than the owner may see the friend list
+func (s Settings) FriendListVisibleTo(isFriend bool) bool {
+	switch s.FriendListVisibility {
+	case FriendListEveryone:
+		return true
+	case FriendListFriends:
+		return isFriend
+	}
+
+	return false
+}
+
+// CommentAllowedFrom reports whether a user other than the owner may comment on the owner's posts
+func (s Settings) CommentAllowedFrom(isFriend bool) bool {
+	return s.CommentPermission == CommentEveryone || isFriend
+}
+
+// PresentFields lists the JSON names of the fields the request changes
+func (r *UpdateSettingsRequest) PresentFields() []string {
+	fields := []string{}
+	if r.Discoverable != nil {
+		fields = append(fields, "discoverable")
+	}
+	if r.FriendListVisibility != nil {
+		fields = append(fields, "friendListVisibility")
+	}
+	if r.CommentPermission != nil {
+		fields = append(fields, "commentPermission")
+	}
+
+	return fields
+}
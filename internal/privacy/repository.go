@@ -0,0 +1,74 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type PrivacyRepo struct {
+	db *sqlx.DB
+}
+
+func NewPrivacyRepo(db *sqlx.DB) PrivacyRepo {
+	return PrivacyRepo{db: db}
+}
+
+// GetSettings returns the user's settings, or the defaults when they never changed them
+func (r *PrivacyRepo) GetSettings(ctx context.Context, userID string) (Settings, error) {
+	var result Settings
+
+	query := `
+		SELECT
+			user_id,
+			discoverable,
+			friend_list_visibility,
+			comment_permission,
+			updated_at
+		FROM
+			user_privacy_settings
+		WHERE
+			user_id = $1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, userID)
+	if err == sql.ErrNoRows {
+		return DefaultSettings(userID), nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (r *PrivacyRepo) SaveSettings(ctx context.Context, tx *sql.Tx, settings Settings) error {
+	query := `
+		INSERT INTO user_privacy_settings
+			(user_id, discoverable, friend_list_visibility, comment_permission, updated_at)
+		VALUES
+			(:user_id, :discoverable, :friend_list_visibility, :comment_permission, :updated_at)
+		ON CONFLICT (user_id) DO UPDATE SET
+			discoverable = EXCLUDED.discoverable,
+			friend_list_visibility = EXCLUDED.friend_list_visibility,
+			comment_permission = EXCLUDED.comment_permission,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, settings)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
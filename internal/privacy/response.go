@@ -0,0 +1,15 @@
+package privacy
+
+type SettingsResponse struct {
+	Discoverable         bool   `json:"discoverable"`
+	FriendListVisibility string `json:"friendListVisibility"`
+	CommentPermission    string `json:"commentPermission"`
+}
+
+func newSettingsResponse(settings Settings) SettingsResponse {
+	return SettingsResponse{
+		Discoverable:         settings.Discoverable,
+		FriendListVisibility: settings.FriendListVisibility,
+		CommentPermission:    settings.CommentPermission,
+	}
+}
@@ -0,0 +1,261 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/friend"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/personaltoken"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/privacy"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/user"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/handle"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+type profileHandler struct {
+	userRepo    *user.UserRepo
+	friendRepo  *friend.FriendRepo
+	privacyRepo *privacy.PrivacyRepo
+}
+
+type ProfileHandlerConfig struct {
+	UserRepo    *user.UserRepo
+	FriendRepo  *friend.FriendRepo
+	PrivacyRepo *privacy.PrivacyRepo
+}
+
+func NewProfileHandler(cfg ProfileHandlerConfig) profileHandler {
+	return profileHandler{
+		userRepo:    cfg.UserRepo,
+		friendRepo:  cfg.FriendRepo,
+		privacyRepo: cfg.PrivacyRepo,
+	}
+}
+
+func (h *profileHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
+	group := r.Group("/v1/user")
+	// personal access tokens can read profiles with the profile:read scope
+	authMiddleware := jwtProvider.Middleware(personaltoken.ScopeProfileRead)
+
+	group.Get("/me", authMiddleware, h.GetMyProfile)
+	// the guid constraint keeps this route from shadowing the other /v1/user/* GET routes
+	group.Get("/:userId<guid>", authMiddleware, h.GetProfile)
+	group.Get("/handle/:handle", authMiddleware, h.GetProfileByHandle)
+	group.Get("/handle/:handle/available", authMiddleware, h.CheckHandleAvailability)
+}
+
+func (h *profileHandler) GetMyProfile(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	u, err := h.userRepo.GetUserByID(c.Context(), claims.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrUserNotFound
+		}
+
+		return errors.Wrap(err, "GetUserByID error")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data: MyProfileResponse{
+			UserID:          u.ID,
+			Name:            u.Name,
+			Username:        u.Username.String,
+			Role:            u.Role,
+			Email:           u.Email.String,
+			Phone:           u.Phone.String,
+			ImageURL:        u.ImageURL.String,
+			FriendCount:     u.FriendCount,
+			Bio:             u.Bio.String,
+			CoverImageURL:   u.CoverImageURL.String,
+			Location:        u.Location.String,
+			Website:         u.Website.String,
+			Birthday:        user.FormatBirthday(u.Birthday),
+			EmailVerifiedAt: nullTimeToPtr(u.EmailVerifiedAt),
+			PhoneVerifiedAt: nullTimeToPtr(u.PhoneVerifiedAt),
+			CreatedAt:       u.CreatedAt,
+		},
+	})
+}
+
+func (h *profileHandler) GetProfile(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	ctx := c.Context()
+	u, err := h.userRepo.GetUserByID(ctx, c.Params("userId"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrUserNotFound
+		}
+
+		return errors.Wrap(err, "GetUserByID error")
+	}
+
+	response, err := h.getProfile(ctx, claims.UserID, u)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    response,
+	})
+}
+
+func (h *profileHandler) GetProfileByHandle(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	ctx := c.Context()
+	u, err := h.userRepo.GetUserByUsername(ctx, handle.Normalize(c.Params("handle")))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrHandleNotFound
+		}
+
+		return errors.Wrap(err, "GetUserByUsername error")
+	}
+
+	response, err := h.getProfile(ctx, claims.UserID, u)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    response,
+	})
+}
+
+func (h *profileHandler) CheckHandleAvailability(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	response, err := h.checkHandleAvailability(c.Context(), claims.UserID, c.Params("handle"))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    response,
+	})
+}
+
+func (h *profileHandler) checkHandleAvailability(ctx context.Context, userID, requested string) (HandleAvailabilityResponse, error) {
+	requested = strings.TrimPrefix(strings.TrimSpace(requested), "@")
+	response := HandleAvailabilityResponse{Handle: requested}
+
+	if err := handle.Validate(requested); err != nil {
+		response.Reason = err.Error()
+		return response, nil
+	}
+
+	u, err := h.userRepo.GetUserByUsername(ctx, requested)
+	if err != nil && err != sql.ErrNoRows {
+		return response, errors.Wrap(err, "GetUserByUsername error")
+	}
+
+	// the user's own handle is still available to them, e.g. to change its casing
+	if err == nil && u.ID != userID {
+		response.Reason = "handle is already taken"
+		return response, nil
+	}
+
+	response.Available = true
+	return response, nil
+}
+
+// getProfile returns the public part of u's profile, along with how it relates to the viewer
+func (h *profileHandler) getProfile(ctx context.Context, viewerID string, u user.User) (ProfileResponse, error) {
+	targetID := u.ID
+	friendCount := u.FriendCount
+	response := ProfileResponse{
+		UserID:           u.ID,
+		Name:             u.Name,
+		Username:         u.Username.String,
+		ImageURL:         u.ImageURL.String,
+		FriendCount:      &friendCount,
+		Bio:              u.Bio.String,
+		CoverImageURL:    u.CoverImageURL.String,
+		Location:         u.Location.String,
+		Website:          u.Website.String,
+		CreatedAt:        u.CreatedAt,
+		FriendshipStatus: FriendshipStatusNone,
+	}
+
+	if viewerID == targetID {
+		response.FriendshipStatus = FriendshipStatusSelf
+		response.MutualFriendCount = new(int)
+		return response, nil
+	}
+
+	isFriend, err := h.friendRepo.IsUserFriendWith(ctx, viewerID, targetID)
+	if err != nil {
+		return response, errors.Wrap(err, "IsUserFriendWith error")
+	}
+	if isFriend {
+		response.FriendshipStatus = FriendshipStatusFriend
+	} else {
+		response.FriendshipStatus, err = h.pendingRequestStatus(ctx, viewerID, targetID)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	settings, err := h.privacyRepo.GetSettings(ctx, targetID)
+	if err != nil {
+		return response, errors.Wrap(err, "GetSettings error")
+	}
+
+	// mutual friends are part of the friend list too
+	if !settings.FriendListVisibleTo(isFriend) {
+		response.FriendCount = nil
+		return response, nil
+	}
+
+	mutualFriendCount, err := h.friendRepo.CountMutualFriends(ctx, viewerID, targetID)
+	if err != nil {
+		return response, errors.Wrap(err, "CountMutualFriends error")
+	}
+	response.MutualFriendCount = &mutualFriendCount
+
+	return response, nil
+}
+
+// pendingRequestStatus tells whether a friend request between the viewer and the target waits for an answer
+func (h *profileHandler) pendingRequestStatus(ctx context.Context, viewerID, targetID string) (string, error) {
+	sent, err := h.friendRepo.GetRequestStatus(ctx, viewerID, targetID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", errors.Wrap(err, "GetRequestStatus error")
+	}
+	if sent == friend.StatusPending {
+		return FriendshipStatusRequestSent, nil
+	}
+
+	received, err := h.friendRepo.GetRequestStatus(ctx, targetID, viewerID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", errors.Wrap(err, "GetRequestStatus error")
+	}
+	if received == friend.StatusPending {
+		return FriendshipStatusRequestReceived, nil
+	}
+
+	return FriendshipStatusNone, nil
+}
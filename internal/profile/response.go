@@ -0,0 +1,67 @@
+package profile
+
+import (
+	"database/sql"
+	"time"
+)
+
+// friendship states of a profile as seen by the viewer
+const (
+	FriendshipStatusSelf   = "self"
+	FriendshipStatusFriend = "friend"
+	FriendshipStatusNone   = "none"
+	// a friend request is pending, sent by the viewer or to the viewer
+	FriendshipStatusRequestSent     = "request_sent"
+	FriendshipStatusRequestReceived = "request_received"
+)
+
+type MyProfileResponse struct {
+	UserID          string     `json:"userId"`
+	Name            string     `json:"name"`
+	Username        string     `json:"username"`
+	Role            string     `json:"role"`
+	Email           string     `json:"email"`
+	Phone           string     `json:"phone"`
+	ImageURL        string     `json:"imageUrl"`
+	FriendCount     int        `json:"friendCount"`
+	Bio             string     `json:"bio"`
+	CoverImageURL   string     `json:"coverImageUrl"`
+	Location        string     `json:"location"`
+	Website         string     `json:"website"`
+	Birthday        *string    `json:"birthday"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	PhoneVerifiedAt *time.Time `json:"phoneVerifiedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// ProfileResponse has a null friendCount and mutualFriendCount when the user hides
+// their friend list from the viewer
+type ProfileResponse struct {
+	UserID            string    `json:"userId"`
+	Name              string    `json:"name"`
+	Username          string    `json:"username"`
+	ImageURL          string    `json:"imageUrl"`
+	FriendCount       *int      `json:"friendCount"`
+	Bio               string    `json:"bio"`
+	CoverImageURL     string    `json:"coverImageUrl"`
+	Location          string    `json:"location"`
+	Website           string    `json:"website"`
+	CreatedAt         time.Time `json:"createdAt"`
+	FriendshipStatus  string    `json:"friendshipStatus"`
+	MutualFriendCount *int      `json:"mutualFriendCount"`
+}
+
+type HandleAvailabilityResponse struct {
+	Handle    string `json:"handle"`
+	Available bool   `json:"available"`
+	// Reason explains why an unavailable handle cannot be used
+	Reason string `json:"reason,omitempty"`
+}
+
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
@@ -0,0 +1,27 @@
+package role
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// permissions granted to roles in the role_permissions table
+const (
+	PermissionModeratePosts = "posts:moderate"
+	PermissionModerateUsers = "users:moderate"
+	PermissionBanUsers      = "users:ban"
+	PermissionAssignRoles   = "roles:assign"
+	PermissionReadAudit     = "audit:read"
+)
+
+func IsValid(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+
+	TargetUserID string
+	UserID       string
+}
@@ -0,0 +1,94 @@
+package role
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RoleRepo struct {
+	db *sqlx.DB
+}
+
+func NewRoleRepo(db *sqlx.DB) RoleRepo {
+	return RoleRepo{db: db}
+}
+
+func (r *RoleRepo) GetPermissions(ctx context.Context, role string) ([]string, error) {
+	permissions := []string{}
+
+	query := `
+		SELECT
+			permission
+		FROM
+			role_permissions
+		WHERE
+			role = $1
+		ORDER BY
+			permission
+	`
+
+	err := r.db.SelectContext(ctx, &permissions, query, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// SetUserRole returns sql.ErrNoRows when the user does not exist
+func (r *RoleRepo) SetUserRole(ctx context.Context, tx *sql.Tx, userID, role string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			role = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, role)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, role)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *RoleRepo) CountUsersWithRole(ctx context.Context, role string) (int, error) {
+	var count int
+
+	query := `
+		SELECT
+			COUNT(*)
+		FROM
+			users
+		WHERE
+			role = $1
+	`
+
+	err := r.db.GetContext(ctx, &count, query, role)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
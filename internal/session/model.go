@@ -0,0 +1,44 @@
+package session
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session groups every refresh token issued from a single login.
+// Rotating a refresh token keeps the session, revoking the session kills the whole token family
+type Session struct {
+	ID        string       `db:"id"`
+	UserID    string       `db:"user_id"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	RevokedAt sql.NullTime `db:"revoked_at"`
+	CreatedAt time.Time    `db:"created_at"`
+
+	// the device the session was started from
+	UserAgent string `db:"user_agent"`
+	IP        string `db:"ip"`
+	// LastSeenAt is refreshed at most once per revocation cache period, see Revoker
+	LastSeenAt sql.NullTime `db:"last_seen_at"`
+}
+
+type RefreshToken struct {
+	ID        string       `db:"id"`
+	SessionID string       `db:"session_id"`
+	TokenHash string       `db:"token_hash"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	UsedAt    sql.NullTime `db:"used_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+type RefreshTokenDetail struct {
+	RefreshToken
+	// Session fields
+	UserID           string       `db:"user_id"`
+	SessionRevokedAt sql.NullTime `db:"session_revoked_at"`
+}
+
+type RevokedAccessToken struct {
+	JTI       string    `db:"jti"`
+	UserID    string    `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
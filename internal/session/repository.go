@@ -0,0 +1,417 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type SessionRepo struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepo(db *sqlx.DB) SessionRepo {
+	return SessionRepo{db: db}
+}
+
+func (r *SessionRepo) CreateSession(ctx context.Context, tx *sql.Tx, session Session) error {
+	query := `
+		INSERT INTO user_sessions
+			(id, user_id, expires_at, user_agent, ip, last_seen_at)
+		VALUES
+			(:id, :user_id, :expires_at, :user_agent, :ip, :last_seen_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, session)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) CreateRefreshToken(ctx context.Context, tx *sql.Tx, refreshToken RefreshToken) error {
+	query := `
+		INSERT INTO user_refresh_tokens
+			(id, session_id, token_hash, expires_at)
+		VALUES
+			(:id, :session_id, :token_hash, :expires_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshTokenDetail, error) {
+	var result RefreshTokenDetail
+
+	query := `
+		SELECT
+			rt.id AS id,
+			rt.session_id AS session_id,
+			rt.token_hash AS token_hash,
+			rt.expires_at AS expires_at,
+			rt.used_at AS used_at,
+			rt.created_at AS created_at,
+
+			-- session fields
+			s.user_id AS user_id,
+			s.revoked_at AS session_revoked_at
+		FROM
+			user_refresh_tokens rt
+			INNER JOIN user_sessions s
+			ON rt.session_id = s.id
+		WHERE
+			rt.token_hash = $1
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, tokenHash)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// MarkRefreshTokenUsed flags the refresh token as rotated. It returns false when the token
+// was already used, which happens when two requests race to rotate the same token
+func (r *SessionRepo) MarkRefreshTokenUsed(ctx context.Context, tx *sql.Tx, id string, usedAt time.Time) (bool, error) {
+	query := `
+		UPDATE
+			user_refresh_tokens
+		SET
+			used_at = $2
+		WHERE
+			id = $1
+			AND used_at IS NULL
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, id, usedAt)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, id, usedAt)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// ExtendSession pushes the expiry of the session back on refresh, which also counts as the session being seen
+func (r *SessionRepo) ExtendSession(ctx context.Context, tx *sql.Tx, sessionID string, expiresAt time.Time) error {
+	query := `
+		UPDATE
+			user_sessions
+		SET
+			expires_at = $2,
+			last_seen_at = NOW(),
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, sessionID, expiresAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, sessionID, expiresAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) RevokeSession(ctx context.Context, tx *sql.Tx, sessionID string, revokedAt time.Time) error {
+	query := `
+		UPDATE
+			user_sessions
+		SET
+			revoked_at = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+			AND revoked_at IS NULL
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, sessionID, revokedAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, sessionID, revokedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) RevokeUserSessions(ctx context.Context, tx *sql.Tx, userID string, revokedAt time.Time) error {
+	query := `
+		UPDATE
+			user_sessions
+		SET
+			revoked_at = $2,
+			updated_at = NOW()
+		WHERE
+			user_id = $1
+			AND revoked_at IS NULL
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, revokedAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, revokedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) CreateRevokedAccessToken(ctx context.Context, tx *sql.Tx, revokedToken RevokedAccessToken) error {
+	query := `
+		INSERT INTO revoked_access_tokens
+			(jti, user_id, expires_at)
+		VALUES
+			(:jti, :user_id, :expires_at)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, revokedToken)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RedeemToken marks a single-use token as spent, returning false if it was already redeemed
+func (r *SessionRepo) RedeemToken(ctx context.Context, tx *sql.Tx, redeemedToken RevokedAccessToken) (bool, error) {
+	query := `
+		INSERT INTO revoked_access_tokens
+			(jti, user_id, expires_at)
+		VALUES
+			(:jti, :user_id, :expires_at)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, redeemedToken)
+	if err != nil {
+		return false, err
+	}
+
+	var result sql.Result
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		result, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (r *SessionRepo) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var isRevoked bool
+
+	query := `
+		SELECT EXISTS(
+			SELECT 1
+			FROM revoked_access_tokens
+			WHERE jti = $1
+		) AS "exists"
+	`
+
+	err := r.db.GetContext(ctx, &isRevoked, query, jti)
+	if err != nil {
+		return isRevoked, err
+	}
+
+	return isRevoked, nil
+}
+
+// SetUserTokensRevokedBefore invalidates every access token of the user issued before revokedBefore
+func (r *SessionRepo) SetUserTokensRevokedBefore(ctx context.Context, tx *sql.Tx, userID string, revokedBefore time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations
+			(user_id, revoked_before)
+		VALUES
+			($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET
+			revoked_before = EXCLUDED.revoked_before,
+			updated_at = NOW()
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, revokedBefore)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, revokedBefore)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *SessionRepo) GetUserTokensRevokedBefore(ctx context.Context, userID string) (sql.NullTime, error) {
+	var revokedBefore sql.NullTime
+
+	query := `
+		SELECT
+			revoked_before
+		FROM
+			user_token_revocations
+		WHERE
+			user_id = $1
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &revokedBefore, query, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return revokedBefore, err
+	}
+
+	return revokedBefore, nil
+}
+
+// ListActiveSessions returns the sessions of the user which are neither revoked nor expired, most recently used first
+func (r *SessionRepo) ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]Session, error) {
+	sessions := []Session{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			expires_at,
+			revoked_at,
+			created_at,
+			user_agent,
+			ip,
+			last_seen_at
+		FROM
+			user_sessions
+		WHERE
+			user_id = $1
+			AND revoked_at IS NULL
+			AND expires_at > $2
+		ORDER BY
+			COALESCE(last_seen_at, created_at) DESC
+	`
+
+	err := r.db.SelectContext(ctx, &sessions, query, userID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *SessionRepo) GetSession(ctx context.Context, sessionID string) (Session, error) {
+	var result Session
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			expires_at,
+			revoked_at,
+			created_at,
+			user_agent,
+			ip,
+			last_seen_at
+		FROM
+			user_sessions
+		WHERE
+			id = $1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, sessionID)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// TouchSession records that the session was just used and returns when it was revoked, if it was.
+// Returns sql.ErrNoRows when the session does not exist anymore
+func (r *SessionRepo) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) (sql.NullTime, error) {
+	var revokedAt sql.NullTime
+
+	query := `
+		UPDATE
+			user_sessions
+		SET
+			last_seen_at = $2
+		WHERE
+			id = $1
+		RETURNING
+			revoked_at
+	`
+
+	err := r.db.GetContext(ctx, &revokedAt, query, sessionID, seenAt)
+	if err != nil {
+		return revokedAt, err
+	}
+
+	return revokedAt, nil
+}
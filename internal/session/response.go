@@ -0,0 +1,29 @@
+package session
+
+import "time"
+
+type SessionResponse struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt *time.Time `json:"lastSeenAt"`
+	// Current marks the session the request was made from
+	Current bool `json:"current"`
+}
+
+// NewSessionResponse converts session for the session listing
+func NewSessionResponse(session Session, currentSessionID string) SessionResponse {
+	resp := SessionResponse{
+		ID:        session.ID,
+		UserAgent: session.UserAgent,
+		IP:        session.IP,
+		CreatedAt: session.CreatedAt,
+		Current:   session.ID == currentSessionID,
+	}
+	if session.LastSeenAt.Valid {
+		resp.LastSeenAt = &session.LastSeenAt.Time
+	}
+
+	return resp
+}
@@ -0,0 +1,269 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/pkg/errors"
+)
+
+type tokenCacheEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+type userCacheEntry struct {
+	revokedBefore time.Time
+	expiresAt     time.Time
+}
+
+// Revoker stores access token revocations in the database and answers the JWT middleware
+// from an in-process cache. Revocations are cached until the token itself expires, while
+// "not revoked" answers are only kept for cacheTTL, which bounds how long a revocation made
+// on another instance can take to be picked up.
+// Looking up a session also records it as last seen, so sessions in use are refreshed once per cacheTTL
+type Revoker struct {
+	sessionRepo *SessionRepo
+	cacheTTL    time.Duration
+
+	mu           sync.RWMutex
+	tokenCache   map[string]tokenCacheEntry
+	sessionCache map[string]tokenCacheEntry
+	userCache    map[string]userCacheEntry
+	lastSweep    time.Time
+}
+
+func NewRevoker(sessionRepo *SessionRepo, cacheTTL time.Duration) *Revoker {
+	return &Revoker{
+		sessionRepo:  sessionRepo,
+		cacheTTL:     cacheTTL,
+		tokenCache:   map[string]tokenCacheEntry{},
+		sessionCache: map[string]tokenCacheEntry{},
+		userCache:    map[string]userCacheEntry{},
+		lastSweep:    time.Now(),
+	}
+}
+
+// IsRevoked implements jwt.RevocationChecker
+func (r *Revoker) IsRevoked(ctx context.Context, user jwt.JWTUser) (bool, error) {
+	revokedBefore, err := r.getUserRevokedBefore(ctx, user.UserID)
+	if err != nil {
+		return false, err
+	}
+	// iat has millisecond precision, so a token issued in the millisecond of the revocation cannot be
+	// told apart from one issued right before it. Both are revoked, a surviving one would stay usable
+	if !revokedBefore.IsZero() && !user.IssuedAt.After(revokedBefore.Truncate(time.Millisecond)) {
+		return true, nil
+	}
+
+	if user.SessionID != "" {
+		revoked, err := r.isSessionRevoked(ctx, user)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	if user.TokenID == "" {
+		return false, nil
+	}
+
+	return r.isTokenRevoked(ctx, user.TokenID)
+}
+
+func (r *Revoker) isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	now := time.Now()
+
+	r.mu.RLock()
+	entry, found := r.tokenCache[jti]
+	r.mu.RUnlock()
+	if found && now.Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := r.sessionRepo.IsAccessTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, errors.Wrap(err, "IsAccessTokenRevoked error")
+	}
+
+	r.mu.Lock()
+	r.tokenCache[jti] = tokenCacheEntry{
+		revoked:   revoked,
+		expiresAt: now.Add(r.cacheTTL),
+	}
+	r.sweep(now)
+	r.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (r *Revoker) isSessionRevoked(ctx context.Context, user jwt.JWTUser) (bool, error) {
+	now := time.Now()
+
+	r.mu.RLock()
+	entry, found := r.sessionCache[user.SessionID]
+	r.mu.RUnlock()
+	if found && now.Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	revokedAt, err := r.sessionRepo.TouchSession(ctx, user.SessionID, now.UTC())
+	if err != nil && err != sql.ErrNoRows {
+		return false, errors.Wrap(err, "TouchSession error")
+	}
+	// a session which is gone was purged along with its user
+	revoked := err == sql.ErrNoRows || revokedAt.Valid
+
+	expiresAt := now.Add(r.cacheTTL)
+	if revoked {
+		expiresAt = user.ExpiresAt
+	}
+
+	r.mu.Lock()
+	r.sessionCache[user.SessionID] = tokenCacheEntry{
+		revoked:   revoked,
+		expiresAt: expiresAt,
+	}
+	r.sweep(now)
+	r.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (r *Revoker) getUserRevokedBefore(ctx context.Context, userID string) (time.Time, error) {
+	now := time.Now()
+
+	r.mu.RLock()
+	entry, found := r.userCache[userID]
+	r.mu.RUnlock()
+	if found && now.Before(entry.expiresAt) {
+		return entry.revokedBefore, nil
+	}
+
+	revokedBefore, err := r.sessionRepo.GetUserTokensRevokedBefore(ctx, userID)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "GetUserTokensRevokedBefore error")
+	}
+
+	r.mu.Lock()
+	r.userCache[userID] = userCacheEntry{
+		revokedBefore: revokedBefore.Time,
+		expiresAt:     now.Add(r.cacheTTL),
+	}
+	r.sweep(now)
+	r.mu.Unlock()
+
+	return revokedBefore.Time, nil
+}
+
+// RevokeToken revokes a single access token until it expires
+func (r *Revoker) RevokeToken(ctx context.Context, user jwt.JWTUser) error {
+	if user.TokenID == "" {
+		return nil
+	}
+
+	err := r.sessionRepo.CreateRevokedAccessToken(ctx, nil, RevokedAccessToken{
+		JTI:       user.TokenID,
+		UserID:    user.UserID,
+		ExpiresAt: user.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "CreateRevokedAccessToken error")
+	}
+
+	r.mu.Lock()
+	r.tokenCache[user.TokenID] = tokenCacheEntry{
+		revoked:   true,
+		expiresAt: user.ExpiresAt,
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// RevokeSession ends the session, which revokes its refresh token and every access token issued for it
+func (r *Revoker) RevokeSession(ctx context.Context, sessionID string) error {
+	now := time.Now().UTC()
+
+	err := r.sessionRepo.RevokeSession(ctx, nil, sessionID, now)
+	if err != nil {
+		return errors.Wrap(err, "RevokeSession error")
+	}
+
+	// access tokens live for hours at most, keeping the entry past that is harmless
+	r.mu.Lock()
+	r.sessionCache[sessionID] = tokenCacheEntry{
+		revoked:   true,
+		expiresAt: now.Add(24 * time.Hour),
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUser revokes every access token of the user issued before now, along with all of
+// the user's sessions so that no refresh token can mint a new access token either
+func (r *Revoker) RevokeUser(ctx context.Context, userID string) error {
+	now := time.Now().UTC()
+
+	err := r.revokeAccessTokensBefore(ctx, userID, now)
+	if err != nil {
+		return err
+	}
+
+	err = r.sessionRepo.RevokeUserSessions(ctx, nil, userID, now)
+	if err != nil {
+		return errors.Wrap(err, "RevokeUserSessions error")
+	}
+
+	return nil
+}
+
+// RevokeUserAccessTokens revokes every access token of the user issued before now but keeps the
+// sessions, so clients refresh into tokens carrying the user's current claims
+func (r *Revoker) RevokeUserAccessTokens(ctx context.Context, userID string) error {
+	return r.revokeAccessTokensBefore(ctx, userID, time.Now().UTC())
+}
+
+func (r *Revoker) revokeAccessTokensBefore(ctx context.Context, userID string, now time.Time) error {
+	err := r.sessionRepo.SetUserTokensRevokedBefore(ctx, nil, userID, now)
+	if err != nil {
+		return errors.Wrap(err, "SetUserTokensRevokedBefore error")
+	}
+
+	r.mu.Lock()
+	r.userCache[userID] = userCacheEntry{
+		revokedBefore: now,
+		expiresAt:     time.Now().Add(r.cacheTTL),
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// sweep drops expired cache entries. Must be called with the write lock held
+func (r *Revoker) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < 10*r.cacheTTL {
+		return
+	}
+
+	for key, entry := range r.tokenCache {
+		if now.After(entry.expiresAt) {
+			delete(r.tokenCache, key)
+		}
+	}
+	for key, entry := range r.sessionCache {
+		if now.After(entry.expiresAt) {
+			delete(r.sessionCache, key)
+		}
+	}
+	for key, entry := range r.userCache {
+		if now.After(entry.expiresAt) {
+			delete(r.userCache, key)
+		}
+	}
+
+	r.lastSweep = now
+}
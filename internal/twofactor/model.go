@@ -0,0 +1,33 @@
+package twofactor
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes are handed out when 2FA is enabled
+const RecoveryCodeCount = 10
+
+// TOTP is the authenticator enrollment of a user. It only protects logins once confirmed
+type TOTP struct {
+	UserID string `db:"user_id"`
+	// Secret is encrypted with the application key, except in rows stored before secrets were encrypted
+	Secret      string       `db:"secret"`
+	ConfirmedAt sql.NullTime `db:"confirmed_at"`
+	// LastUsedStep is the time step of the last accepted code, so a code cannot be replayed
+	LastUsedStep int64     `db:"last_used_step"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+func (t TOTP) Enabled() bool {
+	return t.ConfirmedAt.Valid
+}
+
+// RecoveryCode is a one-time code usable in place of a TOTP code. Only its hash is stored
+type RecoveryCode struct {
+	ID        string       `db:"id"`
+	UserID    string       `db:"user_id"`
+	CodeHash  string       `db:"code_hash"`
+	UsedAt    sql.NullTime `db:"used_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
@@ -0,0 +1,306 @@
+package twofactor
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TwoFactorRepo struct {
+	db *sqlx.DB
+}
+
+func NewTwoFactorRepo(db *sqlx.DB) TwoFactorRepo {
+	return TwoFactorRepo{db: db}
+}
+
+func (r *TwoFactorRepo) GetTOTP(ctx context.Context, userID string) (TOTP, error) {
+	var result TOTP
+
+	query := `
+		SELECT
+			user_id,
+			secret,
+			confirmed_at,
+			last_used_step,
+			created_at
+		FROM
+			user_totp
+		WHERE
+			user_id = $1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, userID)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// UpsertPendingTOTP stores a new unconfirmed secret, replacing a previous unconfirmed one.
+// It returns false when the user already has a confirmed enrollment
+func (r *TwoFactorRepo) UpsertPendingTOTP(ctx context.Context, tx *sql.Tx, userID, secret string, now time.Time) (bool, error) {
+	query := `
+		INSERT INTO user_totp
+			(user_id, secret, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at
+		WHERE
+			user_totp.confirmed_at IS NULL
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, secret, now)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, secret, now)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (r *TwoFactorRepo) ConfirmTOTP(ctx context.Context, tx *sql.Tx, userID string, step int64, confirmedAt time.Time) error {
+	query := `
+		UPDATE
+			user_totp
+		SET
+			confirmed_at = $3,
+			last_used_step = $2,
+			updated_at = $3
+		WHERE
+			user_id = $1
+			AND confirmed_at IS NULL
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, step, confirmedAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, step, confirmedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPStep records step as the last accepted one. It returns false when a code of the same
+// or a later step was already accepted, i.e. the code is being replayed
+func (r *TwoFactorRepo) UseTOTPStep(ctx context.Context, tx *sql.Tx, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE
+			user_totp
+		SET
+			last_used_step = $2,
+			updated_at = NOW()
+		WHERE
+			user_id = $1
+			AND last_used_step < $2
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, step)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, step)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// ListPlaintextTOTP returns the enrollments whose secret does not start with encryptedPrefix,
+// i.e. the ones stored before secrets were encrypted
+func (r *TwoFactorRepo) ListPlaintextTOTP(ctx context.Context, encryptedPrefix string) ([]TOTP, error) {
+	result := []TOTP{}
+
+	query := `
+		SELECT
+			user_id,
+			secret,
+			confirmed_at,
+			last_used_step,
+			created_at
+		FROM
+			user_totp
+		WHERE
+			LEFT(secret, LENGTH($1)) <> $1
+	`
+
+	err := r.db.SelectContext(ctx, &result, query, encryptedPrefix)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ReplaceTOTPSecret swaps the stored secret for newSecret, unless it is no longer currentSecret
+// because the user enrolled again in the meantime
+func (r *TwoFactorRepo) ReplaceTOTPSecret(ctx context.Context, tx *sql.Tx, userID, currentSecret, newSecret string) (bool, error) {
+	query := `
+		UPDATE
+			user_totp
+		SET
+			secret = $3,
+			updated_at = NOW()
+		WHERE
+			user_id = $1
+			AND secret = $2
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, currentSecret, newSecret)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, currentSecret, newSecret)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (r *TwoFactorRepo) DeleteTOTP(ctx context.Context, tx *sql.Tx, userID string) error {
+	query := `
+		DELETE FROM
+			user_totp
+		WHERE
+			user_id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepo) CreateRecoveryCodes(ctx context.Context, tx *sql.Tx, codes []RecoveryCode) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO user_recovery_codes
+			(id, user_id, code_hash, created_at)
+		VALUES
+			(:id, :user_id, :code_hash, :created_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, codes)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode burns the unused recovery code matching codeHash. It returns false when there is none
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, tx *sql.Tx, userID, codeHash string, usedAt time.Time) (bool, error) {
+	query := `
+		UPDATE
+			user_recovery_codes
+		SET
+			used_at = $3
+		WHERE
+			user_id = $1
+			AND code_hash = $2
+			AND used_at IS NULL
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, userID, codeHash, usedAt)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, userID, codeHash, usedAt)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (r *TwoFactorRepo) DeleteRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string) error {
+	query := `
+		DELETE FROM
+			user_recovery_codes
+		WHERE
+			user_id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
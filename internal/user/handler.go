@@ -3,36 +3,104 @@ package user
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/identity"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/loginguard"
 	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/session"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/twofactor"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/verification"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/encryption"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/notifier"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/oidc"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/token"
 	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type userHandler struct {
-	userRepo    *UserRepo
-	jwtProvider *jwt.JWTProvider
-	saltCost    int
+	userRepo               *UserRepo
+	sessionRepo            *session.SessionRepo
+	codeRepo               *verification.CodeRepo
+	twoFactorRepo          *twofactor.TwoFactorRepo
+	roleRepo               *role.RoleRepo
+	identityRepo           *identity.IdentityRepo
+	auditRecorder          *audit.Recorder
+	txProvider             *config.TransactionProvider
+	jwtProvider            *jwt.JWTProvider
+	revoker                *session.Revoker
+	loginGuard             *loginguard.Guard
+	emailNotifier          notifier.Notifier
+	smsNotifier            notifier.Notifier
+	passwordHasher         PasswordHasher
+	totpCipher             *encryption.Cipher
+	refreshTokenExpiry     time.Duration
+	verificationCodeExpiry time.Duration
+	deletionGracePeriod    time.Duration
+	oidcProviders          map[string]*oidc.Provider
+	oidcLoginStateExpiry   time.Duration
 }
 
 type UserHandlerConfig struct {
-	UserRepo    *UserRepo
-	JwtProvider *jwt.JWTProvider
-	SaltCost    int
+	UserRepo       *UserRepo
+	SessionRepo    *session.SessionRepo
+	CodeRepo       *verification.CodeRepo
+	TwoFactorRepo  *twofactor.TwoFactorRepo
+	RoleRepo       *role.RoleRepo
+	IdentityRepo   *identity.IdentityRepo
+	AuditRecorder  *audit.Recorder
+	TxProvider     *config.TransactionProvider
+	JwtProvider    *jwt.JWTProvider
+	Revoker        *session.Revoker
+	LoginGuard     *loginguard.Guard
+	EmailNotifier  notifier.Notifier
+	SMSNotifier    notifier.Notifier
+	PasswordHasher PasswordHasher
+	// TOTPCipher encrypts the TOTP secrets at rest
+	TOTPCipher             *encryption.Cipher
+	RefreshTokenExpiry     time.Duration
+	VerificationCodeExpiry time.Duration
+	DeletionGracePeriod    time.Duration
+	// OIDCProviders are the enabled sign-in providers by name
+	OIDCProviders        map[string]*oidc.Provider
+	OIDCLoginStateExpiry time.Duration
 }
 
 func NewUserHandler(cfg UserHandlerConfig) userHandler {
 	return userHandler{
-		userRepo:    cfg.UserRepo,
-		jwtProvider: cfg.JwtProvider,
-		saltCost:    cfg.SaltCost,
+		userRepo:               cfg.UserRepo,
+		sessionRepo:            cfg.SessionRepo,
+		codeRepo:               cfg.CodeRepo,
+		twoFactorRepo:          cfg.TwoFactorRepo,
+		roleRepo:               cfg.RoleRepo,
+		identityRepo:           cfg.IdentityRepo,
+		auditRecorder:          cfg.AuditRecorder,
+		txProvider:             cfg.TxProvider,
+		jwtProvider:            cfg.JwtProvider,
+		revoker:                cfg.Revoker,
+		loginGuard:             cfg.LoginGuard,
+		emailNotifier:          cfg.EmailNotifier,
+		smsNotifier:            cfg.SMSNotifier,
+		passwordHasher:         cfg.PasswordHasher,
+		totpCipher:             cfg.TOTPCipher,
+		refreshTokenExpiry:     cfg.RefreshTokenExpiry,
+		verificationCodeExpiry: cfg.VerificationCodeExpiry,
+		deletionGracePeriod:    cfg.DeletionGracePeriod,
+		oidcProviders:          cfg.OIDCProviders,
+		oidcLoginStateExpiry:   cfg.OIDCLoginStateExpiry,
 	}
 }
 
@@ -44,9 +112,32 @@ func (h *userHandler) RegisterRoute(r *fiber.App, jwtProvider jwt.JWTProvider) {
 
 	userGroup.Post("/register", h.RegisterUser)
 	userGroup.Post("/login", h.Authenticate)
+	userGroup.Post("/login/2fa", h.AuthenticateTwoFactor)
+	userGroup.Post("/token/refresh", h.RefreshToken)
+	userGroup.Post("/logout", authMiddleware, h.Logout)
+	userGroup.Post("/logout/all", authMiddleware, h.LogoutAll)
 	userGroup.Post("/link", authMiddleware, h.LinkEmail)
 	userGroup.Post("/link/phone", authMiddleware, h.LinkPhone)
+	userGroup.Post("/link/verify", authMiddleware, h.VerifyLinkEmail)
+	userGroup.Post("/link/phone/verify", authMiddleware, h.VerifyLinkPhone)
+	userGroup.Post("/credential/change", authMiddleware, h.ChangeCredential)
+	userGroup.Post("/credential/change/verify", authMiddleware, h.VerifyChangeCredential)
 	userGroup.Patch("/", authMiddleware, h.UpdateUser)
+	userGroup.Delete("/", authMiddleware, h.DeleteAccount)
+	userGroup.Patch("/password", authMiddleware, h.ChangePassword)
+	userGroup.Post("/password/forgot", h.ForgotPassword)
+	userGroup.Post("/password/reset", h.ResetPassword)
+	userGroup.Post("/2fa/enroll", authMiddleware, h.EnrollTwoFactor)
+	userGroup.Post("/2fa/confirm", authMiddleware, h.ConfirmTwoFactor)
+	userGroup.Post("/2fa/disable", authMiddleware, h.DisableTwoFactor)
+	userGroup.Get("/sessions", authMiddleware, h.ListSessions)
+	userGroup.Delete("/sessions/:sessionId<guid>", authMiddleware, h.RevokeSession)
+	userGroup.Get("/oidc/:provider/authorize", h.AuthorizeOIDC)
+	userGroup.Get("/oidc/:provider/callback", h.OIDCCallback)
+	userGroup.Post("/oidc/:provider/link", authMiddleware, h.LinkOIDC)
+	userGroup.Post("/oidc/:provider/link/callback", authMiddleware, h.FinishLinkOIDC)
+	userGroup.Delete("/oidc/:provider", authMiddleware, h.UnlinkOIDC)
+	userGroup.Get("/identities", authMiddleware, h.ListIdentities)
 }
 
 func (h *userHandler) RegisterUser(c *fiber.Ctx) error {
@@ -56,46 +147,57 @@ func (h *userHandler) RegisterUser(c *fiber.Ctx) error {
 	}
 
 	if err := payload.Validate(); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		return err
+	}
+
+	if err := h.validatePasswordBytes("password", payload.Password); err != nil {
+		return err
 	}
 
 	// find existing user by credentials
-	user, accessToken, err := h.createUser(c.Context(), payload)
+	ctx := c.Context()
+	requestInfo := audit.RequestInfoFrom(c)
+	user, tokens, err := h.createUser(ctx, payload, requestInfo)
 	if err != nil {
 		return errors.Wrap(err, "create user error")
 	}
 
+	h.auditRecorder.Record(ctx, requestInfo, audit.EventRegister, user.ID, audit.Details{
+		"credentialType": payload.CredentialType,
+	})
+
 	return c.Status(fiber.StatusCreated).JSON(model.DataResponse{
 		Message: "User registered successfully",
 		Data: UserRegisterResponse{
-			Email:       user.Email.String,
-			Phone:       user.Phone.String,
-			Name:        user.Name,
-			AccessToken: accessToken,
+			Email:        user.Email.String,
+			Phone:        user.Phone.String,
+			Name:         user.Name,
+			AccessToken:  tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
 		},
 	})
 }
 
-func (h *userHandler) createUser(ctx context.Context, payload RegisterUserRequest) (User, string, error) {
+func (h *userHandler) createUser(ctx context.Context, payload RegisterUserRequest, device audit.RequestInfo) (User, AuthTokens, error) {
 	_, err := h.userRepo.GetUserByCredential(ctx, payload.CredentialType, payload.CredentialValue)
 	if err != nil && err != sql.ErrNoRows {
-		return User{}, "", errors.Wrap(err, "GetUserByCredential error")
+		return User{}, AuthTokens{}, errors.Wrap(err, "GetUserByCredential error")
 	}
 	if err == nil {
 		// user already exists
-		return User{}, "", config.ErrCredentialExists
+		return User{}, AuthTokens{}, config.ErrCredentialExists
 	}
 
-	// hash the password first using bcrypt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), h.saltCost)
+	hashedPassword, err := h.passwordHasher.Hash(payload.Password)
 	if err != nil {
-		return User{}, "", err
+		return User{}, AuthTokens{}, errors.Wrap(err, "Hash error")
 	}
 
 	user := User{
 		ID:       uuid.NewString(),
 		Name:     payload.Name,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
+		Role:     role.RoleUser,
 	}
 	if payload.CredentialType == "email" {
 		user.Email = sql.NullString{
@@ -108,18 +210,18 @@ func (h *userHandler) createUser(ctx context.Context, payload RegisterUserReques
 			Valid:  true,
 		}
 	}
-	err = h.userRepo.CreateUser(ctx, user)
+	err = h.userRepo.CreateUser(ctx, nil, user)
 	if err != nil {
-		return user, "", err
+		return user, AuthTokens{}, err
 	}
 
-	// generate JWT
-	accessToken, err := h.generateAccessTokenFromUser(user)
+	// generate JWT & refresh token
+	tokens, err := h.issueTokens(ctx, user, device)
 	if err != nil {
-		return user, "", err
+		return user, AuthTokens{}, err
 	}
 
-	return user, accessToken, nil
+	return user, tokens, nil
 }
 
 func (h *userHandler) Authenticate(c *fiber.Ctx) error {
@@ -129,156 +231,469 @@ func (h *userHandler) Authenticate(c *fiber.Ctx) error {
 	}
 
 	if err := payload.Validate(); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		return err
 	}
 
-	user, accessToken, err := h.authenticateUser(c.Context(), payload)
+	ctx := c.Context()
+	requestInfo := audit.RequestInfoFrom(c)
+	credentialKey := loginguard.CredentialKey(payload.CredentialType, payload.CredentialValue)
+
+	retryAfter, err := h.loginGuard.Check(ctx, credentialKey, c.IP())
+	if err != nil {
+		return errors.Wrap(err, "loginGuard.Check error")
+	}
+	if retryAfter > 0 {
+		h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginFailed, "", audit.Details{
+			"credentialType": payload.CredentialType,
+			"reason":         "too_many_attempts",
+		})
+
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return config.ErrTooManyLoginAttempts
+	}
+
+	user, tokens, err := h.authenticateUser(ctx, payload, requestInfo)
 	if err != nil {
+		reason := ""
+		switch {
+		case err == config.ErrUserNotFound:
+			reason = "user_not_found"
+		case err == config.ErrWrongPassword:
+			reason = "wrong_password"
+		case err == config.ErrAccountBanned:
+			reason = "account_banned"
+		case user.IsSuspended(time.Now().UTC()):
+			reason = "account_suspended"
+		}
+
+		if err == config.ErrUserNotFound || err == config.ErrWrongPassword {
+			if guardErr := h.loginGuard.RecordFailure(ctx, reason, credentialKey, c.IP()); guardErr != nil {
+				return errors.Wrap(guardErr, "loginGuard.RecordFailure error")
+			}
+		}
+
+		if reason != "" {
+			h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginFailed, user.ID, audit.Details{
+				"credentialType": payload.CredentialType,
+				"reason":         reason,
+			})
+		}
+
 		return errors.Wrap(err, "create user error")
 	}
 
+	err = h.loginGuard.RecordSuccess(ctx, credentialKey)
+	if err != nil {
+		return errors.Wrap(err, "loginGuard.RecordSuccess error")
+	}
+
+	if tokens.ChallengeToken != "" {
+		// the login is recorded once the second factor is checked
+		return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+			Message: "two-factor authentication required",
+			Data: TwoFactorChallengeResponse{
+				ChallengeToken: tokens.ChallengeToken,
+				ExpiresIn:      int(twoFactorChallengeExpiry.Seconds()),
+			},
+		})
+	}
+
+	h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginSucceeded, user.ID, audit.Details{
+		"credentialType": payload.CredentialType,
+		"method":         "password",
+	})
+
+	response := newUserResponse(user)
+	response.AccessToken = tokens.AccessToken
+	response.RefreshToken = tokens.RefreshToken
+
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
 		Message: "User logged successfully",
-		Data: UserResponse{
-			Email:       user.Email.String,
-			Phone:       user.Phone.String,
-			Name:        user.Name,
-			AccessToken: accessToken,
-		},
+		Data:    response,
 	})
 }
 
-func (h *userHandler) authenticateUser(ctx context.Context, payload AuthenticateRequest) (User, string, error) {
+func (h *userHandler) authenticateUser(ctx context.Context, payload AuthenticateRequest, device audit.RequestInfo) (User, AuthTokens, error) {
 	user, err := h.userRepo.GetUserByCredential(ctx, payload.CredentialType, payload.CredentialValue)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return user, "", config.ErrUserNotFound
+			return user, AuthTokens{}, config.ErrUserNotFound
 		}
 
-		return user, "", errors.Wrap(err, "GetUserByCredential error")
+		return user, AuthTokens{}, errors.Wrap(err, "GetUserByCredential error")
+	}
+
+	if err := h.passwordHasher.Verify(user.Password, payload.Password); err != nil {
+		return user, AuthTokens{}, config.ErrWrongPassword
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
-		return user, "", config.ErrWrongPassword
+	// only told after the password matched, so the state of an account is not disclosed to anyone
+	if err := checkAccountRestriction(user); err != nil {
+		return user, AuthTokens{}, err
 	}
 
-	// generate JWT
-	accessToken, err := h.generateAccessTokenFromUser(user)
+	// the password is only known now, so this is the moment to move the hash to the current algorithm
+	if h.passwordHasher.NeedsRehash(user.Password) {
+		h.rehashPassword(ctx, user, payload.Password)
+	}
+
+	tokens, err := h.completeLogin(ctx, user, device)
 	if err != nil {
-		return user, "", errors.Wrap(err, "generateAccessToken error")
+		return user, AuthTokens{}, err
 	}
 
-	return user, accessToken, nil
+	return user, tokens, nil
 }
 
-func (h *userHandler) generateAccessTokenFromUser(user User) (string, error) {
-	claims := jwt.BuildJWTClaims(jwt.JWTUser{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email.String,
-		Phone:  user.Phone.String,
-	}, 8*time.Hour)
+// completeLogin asks for the second factor when the user enabled it, and otherwise issues the tokens.
+// It is called once the user proved who they are, with a password or through a sign-in provider
+func (h *userHandler) completeLogin(ctx context.Context, user User, device audit.RequestInfo) (AuthTokens, error) {
+	enrollment, err := h.twoFactorRepo.GetTOTP(ctx, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return AuthTokens{}, errors.Wrap(err, "GetTOTP error")
+	}
+	if err == nil && enrollment.Enabled() {
+		challengeToken, err := h.issueTwoFactorChallenge(user)
+		if err != nil {
+			return AuthTokens{}, err
+		}
 
-	accessToken, err := h.jwtProvider.GenerateToken(claims)
+		return AuthTokens{ChallengeToken: challengeToken}, nil
+	}
+
+	// generate JWT & refresh token
+	tokens, err := h.issueTokens(ctx, user, device)
 	if err != nil {
-		return "", err
+		return AuthTokens{}, errors.Wrap(err, "issueTokens error")
 	}
 
-	return accessToken, err
+	return tokens, nil
 }
 
-func (h *userHandler) UpdateUser(c *fiber.Ctx) error {
-	var payload UpdateUserRequest
+// checkAccountRestriction returns the error telling a banned or suspended user why they cannot log in
+func checkAccountRestriction(user User) error {
+	if user.IsBanned() {
+		return config.ErrAccountBanned
+	}
 
-	claims, err := jwt.GetLoggedInUser(c)
+	if user.IsSuspended(time.Now().UTC()) {
+		return fiber.NewError(
+			fiber.StatusForbidden,
+			fmt.Sprintf("account is suspended until %s", user.SuspendedUntil.Time.Format(time.RFC3339)),
+		)
+	}
+
+	return nil
+}
+
+// validatePasswordBytes rejects a new password the current hasher cannot hash. The length rules count
+// characters while bcrypt counts bytes, so this can only be told once the hasher is known
+func (h *userHandler) validatePasswordBytes(field, password string) error {
+	maxBytes := h.passwordHasher.MaxPasswordBytes()
+	if maxBytes == 0 || len(password) <= maxBytes {
+		return nil
+	}
+
+	var validationErrs validation.Errors
+	validationErrs.Add(field, "max", fmt.Sprintf("must be at most %d bytes", maxBytes))
+
+	return validationErrs
+}
+
+// rehashPassword replaces the stored hash of user with one made by the current hasher.
+// A failure here must not fail the login, the old hash still works
+func (h *userHandler) rehashPassword(ctx context.Context, user User, password string) {
+	hashedPassword, err := h.passwordHasher.Hash(password)
 	if err != nil {
-		return config.ErrRequestForbidden
+		// passwords too long for the current hasher keep their old hash
+		if err != ErrPasswordTooLong {
+			log.Println("failed to rehash password: ", err)
+		}
+		return
 	}
-	payload.UserID = claims.UserID
 
+	// user.Password is the hash the password was just verified against
+	err = h.userRepo.UpdatePasswordIfUnchanged(ctx, nil, user.ID, user.Password, hashedPassword)
+	if err != nil {
+		log.Println("failed to store rehashed password: ", err)
+	}
+}
+
+// issueTokens starts a new session for the user on the given device and returns an access token
+// along with the first refresh token of the session's token family
+func (h *userHandler) issueTokens(ctx context.Context, user User, device audit.RequestInfo) (AuthTokens, error) {
+	if err := checkAccountRestriction(user); err != nil {
+		return AuthTokens{}, err
+	}
+
+	now := time.Now().UTC()
+	userSession := session.Session{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		ExpiresAt:  now.Add(h.refreshTokenExpiry),
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		LastSeenAt: sql.NullTime{Time: now, Valid: true},
+	}
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.sessionRepo.CreateSession(ctx, tx, userSession)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "CreateSession error")
+	}
+
+	refreshToken, err := h.createRefreshToken(ctx, tx, userSession.ID, userSession.ExpiresAt)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	// logging in during the grace period keeps the account
+	if user.DeletionScheduledAt.Valid {
+		err = h.userRepo.CancelDeletion(ctx, tx, user.ID)
+		if err != nil {
+			return AuthTokens{}, errors.Wrap(err, "CancelDeletion error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "Commit error")
+	}
+
+	accessToken, err := h.generateAccessTokenFromUser(ctx, user, userSession.ID)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "generateAccessToken error")
+	}
+
+	return AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (h *userHandler) createRefreshToken(ctx context.Context, tx *sql.Tx, sessionID string, expiresAt time.Time) (string, error) {
+	rawToken, err := token.Generate(32)
+	if err != nil {
+		return "", errors.Wrap(err, "token.Generate error")
+	}
+
+	err = h.sessionRepo.CreateRefreshToken(ctx, tx, session.RefreshToken{
+		ID:        uuid.NewString(),
+		SessionID: sessionID,
+		TokenHash: token.Hash(rawToken),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "CreateRefreshToken error")
+	}
+
+	return rawToken, nil
+}
+
+func (h *userHandler) RefreshToken(c *fiber.Ctx) error {
+	var payload RefreshTokenRequest
 	if err := c.BodyParser(&payload); err != nil {
 		return errors.Wrap(config.ErrMalformedRequest, err.Error())
 	}
 
 	if err := validation.Validate(payload); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, err.Error())
-	}
-
-	comps := strings.Split(payload.ImageURL, "/")
-	filename := comps[len(comps)-1]
-	if len(strings.Split(filename, ".")) < 2 {
-		return fiber.ErrBadRequest
+		return err
 	}
 
-	ctx := c.Context()
-	loggedInUser, err := h.updateUser(ctx, payload)
+	tokens, err := h.rotateRefreshToken(c.Context(), payload.RefreshToken, audit.RequestInfoFrom(c))
 	if err != nil {
 		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
-		Message: "user updated successfully",
-		Data: UserResponse{
-			Phone: loggedInUser.Phone.String,
-			Email: loggedInUser.Email.String,
-			Name:  loggedInUser.Name,
+		Message: "token refreshed successfully",
+		Data: TokenResponse{
+			AccessToken:  tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
 		},
 	})
 }
 
-func (h *userHandler) updateUser(ctx context.Context, payload UpdateUserRequest) (User, error) {
-	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+// rotateRefreshToken exchanges a refresh token for a new token pair. Every refresh token can be
+// used exactly once: presenting an already rotated token means it has leaked, so the whole
+// session (token family) is revoked and both the attacker and the user have to log in again
+func (h *userHandler) rotateRefreshToken(ctx context.Context, rawToken string, device audit.RequestInfo) (AuthTokens, error) {
+	now := time.Now().UTC()
+
+	current, err := h.sessionRepo.GetRefreshTokenByHash(ctx, token.Hash(rawToken))
 	if err != nil {
-		return User{}, errors.Wrap(err, "getuserByID error")
+		if err == sql.ErrNoRows {
+			return AuthTokens{}, config.ErrInvalidRefreshToken
+		}
+
+		return AuthTokens{}, errors.Wrap(err, "GetRefreshTokenByHash error")
 	}
 
-	// do update credential
-	loggedInUser.ImageURL = sql.NullString{
-		String: payload.ImageURL,
-		Valid:  true,
+	if current.SessionRevokedAt.Valid {
+		return AuthTokens{}, config.ErrInvalidRefreshToken
 	}
-	loggedInUser.Name = payload.Name
-	err = h.userRepo.UpdateUser(ctx, nil, loggedInUser)
-	if err != nil && err != sql.ErrNoRows {
-		return loggedInUser, errors.Wrap(err, "UpdateUser error")
+
+	if current.UsedAt.Valid {
+		return AuthTokens{}, h.revokeReusedSession(ctx, current, now, device)
 	}
 
-	return loggedInUser, nil
+	if now.After(current.ExpiresAt) {
+		return AuthTokens{}, config.ErrInvalidRefreshToken
+	}
+
+	user, err := h.userRepo.GetUserByID(ctx, current.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AuthTokens{}, config.ErrInvalidRefreshToken
+		}
+
+		return AuthTokens{}, errors.Wrap(err, "GetUserByID error")
+	}
+
+	if err := checkAccountRestriction(user); err != nil {
+		return AuthTokens{}, err
+	}
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	marked, err := h.sessionRepo.MarkRefreshTokenUsed(ctx, tx, current.ID, now)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "MarkRefreshTokenUsed error")
+	}
+	if !marked {
+		// another request rotated this token in the meantime. treat it the same as a reuse
+		tx.Rollback()
+
+		return AuthTokens{}, h.revokeReusedSession(ctx, current, now, device)
+	}
+
+	expiresAt := now.Add(h.refreshTokenExpiry)
+	err = h.sessionRepo.ExtendSession(ctx, tx, current.SessionID, expiresAt)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "ExtendSession error")
+	}
+
+	refreshToken, err := h.createRefreshToken(ctx, tx, current.SessionID, expiresAt)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "Commit error")
+	}
+
+	accessToken, err := h.generateAccessTokenFromUser(ctx, user, current.SessionID)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "generateAccessToken error")
+	}
+
+	return AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
 }
 
-func (h *userHandler) LinkEmail(c *fiber.Ctx) error {
-	var payload LinkCredentialRequest
-	payload.CredentialType = "email"
+// revokeReusedSession ends the session of a refresh token presented a second time
+func (h *userHandler) revokeReusedSession(ctx context.Context, current session.RefreshTokenDetail, now time.Time, device audit.RequestInfo) error {
+	err := h.sessionRepo.RevokeSession(ctx, nil, current.SessionID, now)
+	if err != nil {
+		return errors.Wrap(err, "RevokeSession error")
+	}
+
+	h.auditRecorder.Record(ctx, device, audit.EventTokensRevoked, current.UserID, audit.Details{
+		"reason":    "refresh_token_reused",
+		"sessionId": current.SessionID,
+	})
 
+	return config.ErrRefreshTokenReused
+}
+
+func (h *userHandler) Logout(c *fiber.Ctx) error {
 	claims, err := jwt.GetLoggedInUser(c)
 	if err != nil {
 		return config.ErrRequestForbidden
 	}
-	payload.UserID = claims.UserID
 
-	if err := c.BodyParser(&payload); err != nil {
-		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	ctx := c.Context()
+	err = h.revoker.RevokeToken(ctx, claims)
+	if err != nil {
+		return errors.Wrap(err, "RevokeToken error")
+	}
+
+	// also end the session so its refresh token cannot mint new access tokens
+	if claims.SessionID != "" {
+		err = h.revoker.RevokeSession(ctx, claims.SessionID)
+		if err != nil {
+			return errors.Wrap(err, "RevokeSession error")
+		}
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, claims.UserID, audit.Details{
+		"reason": "logout",
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "user logged out successfully",
+	})
+}
+
+func (h *userHandler) LogoutAll(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
 	}
 
 	ctx := c.Context()
-	loggedInUser, err := h.updateCredential(ctx, payload)
+	err = h.revoker.RevokeUser(ctx, claims.UserID)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "RevokeUser error")
 	}
 
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, claims.UserID, audit.Details{
+		"reason": "logout_all",
+	})
+
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
-		Message: "credential updated successfully",
-		Data: UserResponse{
-			Phone: loggedInUser.Phone.String,
-			Email: loggedInUser.Email.String,
-			Name:  loggedInUser.Name,
-		},
+		Message: "user logged out from all sessions successfully",
 	})
 }
 
-func (h *userHandler) LinkPhone(c *fiber.Ctx) error {
-	var payload LinkCredentialRequest
-	payload.CredentialType = "phone"
+func (h *userHandler) generateAccessTokenFromUser(ctx context.Context, user User, sessionID string) (string, error) {
+	permissions, err := h.roleRepo.GetPermissions(ctx, user.Role)
+	if err != nil {
+		return "", errors.Wrap(err, "GetPermissions error")
+	}
+
+	claims := jwt.BuildJWTClaims(jwt.JWTUser{
+		UserID:      user.ID,
+		Name:        user.Name,
+		Email:       user.Email.String,
+		Phone:       user.Phone.String,
+		SessionID:   sessionID,
+		Role:        user.Role,
+		Permissions: permissions,
+	}, 8*time.Hour)
+
+	accessToken, err := h.jwtProvider.GenerateToken(claims)
+	if err != nil {
+		return "", err
+	}
+
+	return accessToken, err
+}
+
+func (h *userHandler) UpdateUser(c *fiber.Ctx) error {
+	var payload UpdateUserRequest
 
 	claims, err := jwt.GetLoggedInUser(c)
 	if err != nil {
@@ -290,25 +705,71 @@ func (h *userHandler) LinkPhone(c *fiber.Ctx) error {
 		return errors.Wrap(config.ErrMalformedRequest, err.Error())
 	}
 
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	if err := payload.Validate(); err != nil {
+		return err
+	}
+
 	ctx := c.Context()
-	loggedInUser, err := h.updateCredential(ctx, payload)
+	loggedInUser, err := h.updateUser(ctx, payload)
 	if err != nil {
 		return err
 	}
 
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventProfileUpdated, loggedInUser.ID, audit.Details{
+		"fields": strings.Join(payload.PresentFields(), ","),
+	})
+
 	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
-		Message: "credential updated successfully",
-		Data: UserResponse{
-			Phone: loggedInUser.Phone.String,
-			Email: loggedInUser.Email.String,
-			Name:  loggedInUser.Name,
-		},
+		Message: "user updated successfully",
+		Data:    newUserResponse(loggedInUser),
 	})
 }
 
-func (h *userHandler) updateCredential(ctx context.Context, payload LinkCredentialRequest) (User, error) {
-	if err := payload.Validate(); err != nil {
-		return User{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+func (h *userHandler) updateUser(ctx context.Context, payload UpdateUserRequest) (User, error) {
+	// only write the fields present in the request
+	changes := map[string]interface{}{}
+	if payload.Name != nil {
+		changes["name"] = *payload.Name
+	}
+	if payload.Username != nil {
+		changes["username"] = toNullString(*payload.Username)
+	}
+	if payload.ImageURL != nil {
+		changes["image_url"] = toNullString(*payload.ImageURL)
+	}
+	if payload.Bio != nil {
+		changes["bio"] = toNullString(*payload.Bio)
+	}
+	if payload.CoverImageURL != nil {
+		changes["cover_image_url"] = toNullString(*payload.CoverImageURL)
+	}
+	if payload.Location != nil {
+		changes["location"] = toNullString(*payload.Location)
+	}
+	if payload.Website != nil {
+		changes["website"] = toNullString(*payload.Website)
+	}
+	if payload.Birthday != nil {
+		birthday := sql.NullTime{}
+		if *payload.Birthday != "" {
+			// the format is already checked by the validation
+			parsed, _ := time.Parse("2006-01-02", *payload.Birthday)
+			birthday = sql.NullTime{Time: parsed, Valid: true}
+		}
+		changes["birthday"] = birthday
+	}
+
+	err := h.userRepo.UpdateProfile(ctx, nil, payload.UserID, changes)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return User{}, config.ErrUsernameTaken
+		}
+
+		return User{}, errors.Wrap(err, "UpdateProfile error")
 	}
 
 	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
@@ -316,53 +777,716 @@ func (h *userHandler) updateCredential(ctx context.Context, payload LinkCredenti
 		return User{}, errors.Wrap(err, "getuserByID error")
 	}
 
-	var credentialValue string
-	if payload.CredentialType == "email" {
-		// if credentialType is email, but user already have email registered
-		// do not allow user to update email from this API
-		if loggedInUser.Email.String != "" {
-			return loggedInUser, config.ErrCannotChangeCredential
-		}
+	return loggedInUser, nil
+}
 
-		credentialValue = payload.Email
-	} else {
-		// if credentialType is phone, but user already have phone registered
-		// do not allow user to update email from this API
-		if loggedInUser.Phone.String != "" {
-			return loggedInUser, config.ErrCannotChangeCredential
-		}
+func (h *userHandler) DeleteAccount(c *fiber.Ctx) error {
+	var payload DeleteAccountRequest
 
-		credentialValue = payload.Phone
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
 	}
+	payload.UserID = claims.UserID
 
-	// check for existing user which already have the credential
-	// since we already guaranteed user having email/phone cannot use this api to update their existing email/phone
-	// the user fetched here will be another user
-	_, err = h.userRepo.GetUserByCredential(ctx, payload.CredentialType, credentialValue)
-	if err != nil && err != sql.ErrNoRows {
-		return loggedInUser, errors.Wrap(err, "GetUserByCredential error")
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
 	}
-	if err == nil {
-		// user already exists
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	deleteAt, err := h.deleteAccount(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, payload.UserID, audit.Details{
+		"reason": "account_deletion",
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "account scheduled for deletion, log in again before the deletion date to cancel it",
+		Data: AccountDeletionResponse{
+			DeletionScheduledAt: deleteAt,
+		},
+	})
+}
+
+// deleteAccount schedules the account for the purge after the grace period and logs the user out everywhere
+func (h *userHandler) deleteAccount(ctx context.Context, payload DeleteAccountRequest) (time.Time, error) {
+	user, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "GetUserByID error")
+	}
+
+	if err := h.passwordHasher.Verify(user.Password, payload.Password); err != nil {
+		return time.Time{}, config.ErrWrongPassword
+	}
+
+	enrollment, err := h.twoFactorRepo.GetTOTP(ctx, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, errors.Wrap(err, "GetTOTP error")
+	}
+	if err == nil && enrollment.Enabled() {
+		if payload.Code == "" {
+			return time.Time{}, config.ErrInvalidTwoFactorCode
+		}
+
+		err = h.verifySecondFactor(ctx, enrollment, payload.Code)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	deleteAt := time.Now().UTC().Add(h.deletionGracePeriod)
+	err = h.userRepo.ScheduleDeletion(ctx, nil, user.ID, deleteAt)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "ScheduleDeletion error")
+	}
+
+	err = h.revoker.RevokeUser(ctx, user.ID)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "RevokeUser error")
+	}
+
+	return deleteAt, nil
+}
+
+func (h *userHandler) ChangePassword(c *fiber.Ctx) error {
+	var payload ChangePasswordRequest
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	if err := h.validatePasswordBytes("newPassword", payload.NewPassword); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	requestInfo := audit.RequestInfoFrom(c)
+	tokens, err := h.changePassword(ctx, payload, requestInfo)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, requestInfo, audit.EventPasswordChanged, payload.UserID, nil)
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "password changed successfully",
+		Data: TokenResponse{
+			AccessToken:  tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+		},
+	})
+}
+
+func (h *userHandler) changePassword(ctx context.Context, payload ChangePasswordRequest, device audit.RequestInfo) (AuthTokens, error) {
+	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "GetUserByID error")
+	}
+
+	if err := h.passwordHasher.Verify(loggedInUser.Password, payload.OldPassword); err != nil {
+		return AuthTokens{}, config.ErrWrongPassword
+	}
+
+	hashedPassword, err := h.passwordHasher.Hash(payload.NewPassword)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "Hash error")
+	}
+
+	err = h.userRepo.UpdatePassword(ctx, nil, loggedInUser.ID, hashedPassword)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "UpdatePassword error")
+	}
+
+	// every token issued with the old password is revoked, including the one used for this request.
+	// the caller gets a fresh session instead
+	err = h.revoker.RevokeUser(ctx, loggedInUser.ID)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "RevokeUser error")
+	}
+
+	tokens, err := h.issueTokens(ctx, loggedInUser, device)
+	if err != nil {
+		return AuthTokens{}, errors.Wrap(err, "issueTokens error")
+	}
+
+	return tokens, nil
+}
+
+func (h *userHandler) ForgotPassword(c *fiber.Ctx) error {
+	var payload ForgotPasswordRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	err := h.requestPasswordReset(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	// the response is the same whether the account exists or not, so this API
+	// cannot be used to find out which credentials are registered
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "if the account exists, a password reset code has been sent",
+	})
+}
+
+func (h *userHandler) requestPasswordReset(ctx context.Context, payload ForgotPasswordRequest) error {
+	user, err := h.userRepo.GetUserByCredential(ctx, payload.CredentialType, payload.CredentialValue)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		return errors.Wrap(err, "GetUserByCredential error")
+	}
+
+	// send to the credential as stored, the request may have written the phone differently
+	target := user.Email.String
+	if payload.CredentialType == "phone" {
+		target = user.Phone.String
+	}
+
+	rawCode, err := h.createVerificationCode(ctx, user.ID, verification.PurposePasswordReset, target)
+	if err != nil {
+		if err == config.ErrVerificationCodeCooldown {
+			return nil
+		}
+
+		return errors.Wrap(err, "createVerificationCode error")
+	}
+
+	// deliver in the background so the response time does not tell registered credentials apart
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := h.sendVerificationCode(sendCtx, verification.PurposePasswordReset, payload.CredentialType, target, rawCode)
+		if err != nil {
+			log.Println("failed to send password reset code: ", err)
+		}
+	}()
+
+	return nil
+}
+
+func (h *userHandler) ResetPassword(c *fiber.Ctx) error {
+	var payload ResetPasswordRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	// checked before the code is used up, so the user can retry with a shorter password
+	if err := h.validatePasswordBytes("newPassword", payload.NewPassword); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	userID, err := h.resetPassword(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventPasswordReset, userID, audit.Details{
+		"credentialType": payload.CredentialType,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "password reset successfully",
+	})
+}
+
+func (h *userHandler) resetPassword(ctx context.Context, payload ResetPasswordRequest) (string, error) {
+	user, err := h.userRepo.GetUserByCredential(ctx, payload.CredentialType, payload.CredentialValue)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", config.ErrInvalidVerificationCode
+		}
+
+		return "", errors.Wrap(err, "GetUserByCredential error")
+	}
+
+	_, err = h.consumeVerificationCode(ctx, user.ID, verification.PurposePasswordReset, payload.Code)
+	if err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := h.passwordHasher.Hash(payload.NewPassword)
+	if err != nil {
+		return "", errors.Wrap(err, "Hash error")
+	}
+
+	err = h.userRepo.UpdatePassword(ctx, nil, user.ID, hashedPassword)
+	if err != nil {
+		return "", errors.Wrap(err, "UpdatePassword error")
+	}
+
+	// whoever knew the old password must not stay logged in
+	err = h.revoker.RevokeUser(ctx, user.ID)
+	if err != nil {
+		return "", errors.Wrap(err, "RevokeUser error")
+	}
+
+	return user.ID, nil
+}
+
+func (h *userHandler) LinkEmail(c *fiber.Ctx) error {
+	var payload LinkCredentialRequest
+	payload.CredentialType = "email"
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	err = h.requestCredentialLink(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "verification code sent to the email",
+	})
+}
+
+func (h *userHandler) LinkPhone(c *fiber.Ctx) error {
+	var payload LinkCredentialRequest
+	payload.CredentialType = "phone"
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	err = h.requestCredentialLink(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "verification code sent to the phone",
+	})
+}
+
+// requestCredentialLink sends a verification code to the email/phone the user wants to link.
+// The credential is only written to the user once the code is confirmed
+func (h *userHandler) requestCredentialLink(ctx context.Context, payload LinkCredentialRequest) error {
+	if err := payload.Validate(); err != nil {
+		return err
+	}
+
+	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return errors.Wrap(err, "getuserByID error")
+	}
+
+	var credentialValue, purpose string
+	if payload.CredentialType == "email" {
+		// if credentialType is email, but user already have email registered
+		// do not allow user to update email from this API
+		if loggedInUser.Email.String != "" {
+			return config.ErrCannotChangeCredential
+		}
+
+		credentialValue = payload.Email
+		purpose = verification.PurposeLinkEmail
+	} else {
+		// if credentialType is phone, but user already have phone registered
+		// do not allow user to update email from this API
+		if loggedInUser.Phone.String != "" {
+			return config.ErrCannotChangeCredential
+		}
+
+		credentialValue = payload.Phone
+		purpose = verification.PurposeLinkPhone
+	}
+
+	// check for existing user which already have the credential
+	// since we already guaranteed user having email/phone cannot use this api to update their existing email/phone
+	// the user fetched here will be another user
+	_, err = h.userRepo.GetUserByCredential(ctx, payload.CredentialType, credentialValue)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "GetUserByCredential error")
+	}
+	if err == nil {
+		// user already exists
+		return config.ErrCredentialExists
+	}
+
+	rawCode, err := h.createVerificationCode(ctx, loggedInUser.ID, purpose, credentialValue)
+	if err != nil {
+		return err
+	}
+
+	err = h.sendVerificationCode(ctx, purpose, payload.CredentialType, credentialValue, rawCode)
+	if err != nil {
+		return errors.Wrap(err, "sendVerificationCode error")
+	}
+
+	return nil
+}
+
+func (h *userHandler) VerifyLinkEmail(c *fiber.Ctx) error {
+	return h.verifyLink(c, "email")
+}
+
+func (h *userHandler) VerifyLinkPhone(c *fiber.Ctx) error {
+	return h.verifyLink(c, "phone")
+}
+
+func (h *userHandler) verifyLink(c *fiber.Ctx, credentialType string) error {
+	var payload VerifyCredentialRequest
+	payload.CredentialType = credentialType
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	loggedInUser, err := h.confirmCredentialLink(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventCredentialLinked, loggedInUser.ID, audit.Details{
+		"credentialType": credentialType,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "credential updated successfully",
+		Data:    newUserResponse(loggedInUser),
+	})
+}
+
+func (h *userHandler) confirmCredentialLink(ctx context.Context, payload VerifyCredentialRequest) (User, error) {
+	purpose := verification.PurposeLinkEmail
+	if payload.CredentialType == "phone" {
+		purpose = verification.PurposeLinkPhone
+	}
+
+	code, err := h.consumeVerificationCode(ctx, payload.UserID, purpose, payload.Code)
+	if err != nil {
+		return User{}, err
+	}
+
+	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return User{}, errors.Wrap(err, "getuserByID error")
+	}
+
+	// the credential may have been registered by someone else while the code was pending
+	_, err = h.userRepo.GetUserByCredential(ctx, payload.CredentialType, code.Target)
+	if err != nil && err != sql.ErrNoRows {
+		return loggedInUser, errors.Wrap(err, "GetUserByCredential error")
+	}
+	if err == nil {
 		return loggedInUser, config.ErrCredentialExists
 	}
 
 	// do update credential
+	verifiedAt := sql.NullTime{
+		Time:  time.Now().UTC(),
+		Valid: true,
+	}
 	if payload.CredentialType == "email" {
+		if loggedInUser.Email.String != "" {
+			return loggedInUser, config.ErrCannotChangeCredential
+		}
+
 		loggedInUser.Email = sql.NullString{
-			String: credentialValue,
+			String: code.Target,
 			Valid:  true,
 		}
+		loggedInUser.EmailVerifiedAt = verifiedAt
 	} else {
+		if loggedInUser.Phone.String != "" {
+			return loggedInUser, config.ErrCannotChangeCredential
+		}
+
 		loggedInUser.Phone = sql.NullString{
-			String: credentialValue,
+			String: code.Target,
 			Valid:  true,
 		}
+		loggedInUser.PhoneVerifiedAt = verifiedAt
+	}
+	err = h.userRepo.UpdateCredentials(ctx, nil, loggedInUser)
+	if err != nil && err != sql.ErrNoRows {
+		if isUniqueViolation(err) {
+			return loggedInUser, config.ErrCredentialExists
+		}
+
+		return loggedInUser, errors.Wrap(err, "UpdateCredentials error")
+	}
+
+	return loggedInUser, nil
+}
+
+func (h *userHandler) ChangeCredential(c *fiber.Ctx) error {
+	var payload ChangeCredentialRequest
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	err = h.requestCredentialChange(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "verification code sent to the new " + payload.CredentialType,
+	})
+}
+
+// requestCredentialChange re-authenticates the user with their password, then sends
+// a verification code to the new email/phone. Nothing is changed until the code is confirmed
+func (h *userHandler) requestCredentialChange(ctx context.Context, payload ChangeCredentialRequest) error {
+	// reuse the link API validation for the new email/phone format
+	linkPayload := LinkCredentialRequest{CredentialType: payload.CredentialType}
+	if payload.CredentialType == "email" {
+		linkPayload.Email = payload.CredentialValue
+	} else {
+		linkPayload.Phone = payload.CredentialValue
+	}
+	if err := linkPayload.Validate(); err != nil {
+		// the link API names the field after the credential, this API takes it as credentialValue
+		var validationErrs validation.Errors
+		if errors.As(err, &validationErrs) {
+			for i := range validationErrs {
+				validationErrs[i].Field = "credentialValue"
+			}
+		}
+
+		return err
+	}
+	if payload.CredentialType == "phone" {
+		payload.CredentialValue = linkPayload.Phone
+	}
+
+	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return errors.Wrap(err, "getuserByID error")
+	}
+
+	if err := h.passwordHasher.Verify(loggedInUser.Password, payload.Password); err != nil {
+		return config.ErrWrongPassword
+	}
+
+	currentValue, purpose := loggedInUser.Email.String, verification.PurposeChangeEmail
+	if payload.CredentialType == "phone" {
+		currentValue, purpose = loggedInUser.Phone.String, verification.PurposeChangePhone
+	}
+	if currentValue == "" {
+		return config.ErrCredentialNotLinked
+	}
+	if currentValue == payload.CredentialValue {
+		return config.ErrSameCredential
+	}
+
+	_, err = h.userRepo.GetUserByCredential(ctx, payload.CredentialType, payload.CredentialValue)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "GetUserByCredential error")
+	}
+	if err == nil {
+		return config.ErrCredentialExists
+	}
+
+	rawCode, err := h.createVerificationCode(ctx, loggedInUser.ID, purpose, payload.CredentialValue)
+	if err != nil {
+		return err
+	}
+
+	err = h.sendVerificationCode(ctx, purpose, payload.CredentialType, payload.CredentialValue, rawCode)
+	if err != nil {
+		return errors.Wrap(err, "sendVerificationCode error")
+	}
+
+	return nil
+}
+
+func (h *userHandler) VerifyChangeCredential(c *fiber.Ctx) error {
+	var payload VerifyChangeCredentialRequest
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	loggedInUser, err := h.confirmCredentialChange(ctx, payload)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventCredentialChanged, loggedInUser.ID, audit.Details{
+		"credentialType": payload.CredentialType,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "credential updated successfully",
+		Data:    newUserResponse(loggedInUser),
+	})
+}
+
+func (h *userHandler) confirmCredentialChange(ctx context.Context, payload VerifyChangeCredentialRequest) (User, error) {
+	purpose := verification.PurposeChangeEmail
+	if payload.CredentialType == "phone" {
+		purpose = verification.PurposeChangePhone
+	}
+
+	code, err := h.consumeVerificationCode(ctx, payload.UserID, purpose, payload.Code)
+	if err != nil {
+		return User{}, err
 	}
-	err = h.userRepo.UpdateUser(ctx, nil, loggedInUser)
+
+	loggedInUser, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return User{}, errors.Wrap(err, "getuserByID error")
+	}
+
+	_, err = h.userRepo.GetUserByCredential(ctx, payload.CredentialType, code.Target)
 	if err != nil && err != sql.ErrNoRows {
-		return loggedInUser, errors.Wrap(err, "UpdateUser error")
+		return loggedInUser, errors.Wrap(err, "GetUserByCredential error")
+	}
+	if err == nil {
+		return loggedInUser, config.ErrCredentialExists
 	}
 
+	// keep the replaced credential in the history, then swap it in the same transaction
+	history := CredentialHistory{
+		UserID:         loggedInUser.ID,
+		CredentialType: payload.CredentialType,
+	}
+	newValue := sql.NullString{
+		String: code.Target,
+		Valid:  true,
+	}
+	verifiedAt := sql.NullTime{
+		Time:  time.Now().UTC(),
+		Valid: true,
+	}
+	if payload.CredentialType == "email" {
+		history.CredentialValue = loggedInUser.Email.String
+		history.VerifiedAt = loggedInUser.EmailVerifiedAt
+		loggedInUser.Email = newValue
+		loggedInUser.EmailVerifiedAt = verifiedAt
+	} else {
+		history.CredentialValue = loggedInUser.Phone.String
+		history.VerifiedAt = loggedInUser.PhoneVerifiedAt
+		loggedInUser.Phone = newValue
+		loggedInUser.PhoneVerifiedAt = verifiedAt
+	}
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return loggedInUser, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.userRepo.CreateCredentialHistory(ctx, tx, history)
+	if err != nil {
+		return loggedInUser, errors.Wrap(err, "CreateCredentialHistory error")
+	}
+
+	err = h.userRepo.UpdateCredentials(ctx, tx, loggedInUser)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return loggedInUser, config.ErrCredentialExists
+		}
+
+		return loggedInUser, errors.Wrap(err, "UpdateCredentials error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return loggedInUser, errors.Wrap(err, "Commit error")
+	}
+
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := h.sendCredentialChangedNotice(sendCtx, history.CredentialType, history.CredentialValue, code.Target)
+		if err != nil {
+			log.Println("failed to send credential changed notice: ", err)
+		}
+	}()
+
 	return loggedInUser, nil
 }
+
+// toNullString maps an empty string to NULL
+func toNullString(value string) sql.NullString {
+	return sql.NullString{
+		String: value,
+		Valid:  value != "",
+	}
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -9,30 +9,127 @@ type RegisterUserRequest struct {
 	CredentialType  string `json:"credentialType" validate:"required,oneof=email phone"`
 	CredentialValue string `json:"credentialValue" validate:"required"`
 	Name            string `json:"name" validate:"required,min=5,max=50"`
-	Password        string `json:"password" validate:"required,min=5,max=15"`
+	Password        string `json:"password" validate:"required,min=8,max=128"`
 }
 
 type AuthenticateRequest struct {
 	CredentialType  string `json:"credentialType" validate:"required,oneof=email phone"`
 	CredentialValue string `json:"credentialValue" validate:"required"`
-	Password        string `json:"password" validate:"required,min=5,max=15"`
+	// no minimum here, passwords set before the current limits must keep working
+	Password string `json:"password" validate:"required,max=128"`
 }
 
 type LinkCredentialRequest struct {
 	Email string `json:"email" validate:"required_if=CredentialType email,email,min=7,max=50"`
-	Phone string `json:"phone" validate:"required_if=CredentialType phone,startswith=+,min=7,max=13"`
+	Phone string `json:"phone" validate:"required_if=CredentialType phone"`
 
 	CredentialType string
 	UserID         string
 }
 
+type ChangeCredentialRequest struct {
+	CredentialType  string `json:"credentialType" validate:"required,oneof=email phone"`
+	CredentialValue string `json:"credentialValue" validate:"required"`
+	Password        string `json:"password" validate:"required"`
+
+	UserID string
+}
+
+type VerifyChangeCredentialRequest struct {
+	CredentialType string `json:"credentialType" validate:"required,oneof=email phone"`
+	Code           string `json:"code" validate:"required,numeric,len=6"`
+
+	UserID string
+}
+
+type VerifyCredentialRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+
+	CredentialType string
+	UserID         string
+}
+
+// UpdateUserRequest is a partial update: omitted fields stay unchanged, and an empty string
+// clears the optional fields
 type UpdateUserRequest struct {
-	ImageURL string `json:"imageUrl" validate:"required,url"`
-	Name     string `json:"name" validate:"required,min=5,max=50"`
+	ImageURL      *string `json:"imageUrl" validate:"omitnil,url"`
+	Name          *string `json:"name" validate:"omitnil,min=5,max=50"`
+	Username      *string `json:"username"`
+	Bio           *string `json:"bio" validate:"omitnil,max=160"`
+	CoverImageURL *string `json:"coverImageUrl" validate:"omitnil,max=256,eq=|url"`
+	Location      *string `json:"location" validate:"omitnil,max=64"`
+	Website       *string `json:"website" validate:"omitnil,max=256,eq=|http_url"`
+	// Birthday is formatted as YYYY-MM-DD
+	Birthday *string `json:"birthday" validate:"omitnil,eq=|datetime=2006-01-02"`
+
+	UserID string
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	// Code is required when two-factor authentication is enabled
+	Code string `json:"code" validate:"max=16"`
+
+	UserID string
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"oldPassword" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,min=8,max=128,nefield=OldPassword"`
+
+	UserID string
+}
+
+type ForgotPasswordRequest struct {
+	CredentialType  string `json:"credentialType" validate:"required,oneof=email phone"`
+	CredentialValue string `json:"credentialValue" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	CredentialType  string `json:"credentialType" validate:"required,oneof=email phone"`
+	CredentialValue string `json:"credentialValue" validate:"required"`
+	Code            string `json:"code" validate:"required,numeric,len=6"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8,max=128"`
+}
+
+// FinishOIDCLinkRequest carries the query parameters the provider redirected back with
+type FinishOIDCLinkRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
 
 	UserID string
 }
 
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	// Code is either a TOTP code or a recovery code
+	Code string `json:"code" validate:"required,max=16"`
+
+	UserID string
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	// Code is either a TOTP code or a recovery code
+	Code string `json:"code" validate:"required,max=16"`
+}
+
+// AuthTokens is the token pair handed out after a successful register, login or token refresh
+type AuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	// ChallengeToken is set instead of the pair when the login still needs a second factor
+	ChallengeToken string
+}
+
 type User struct {
 	ID        string         `db:"id"`
 	Email     sql.NullString `db:"email"`
@@ -41,4 +138,44 @@ type User struct {
 	Password  string         `db:"password"`
 	ImageURL  sql.NullString `db:"image_url"`
 	CreatedAt time.Time      `db:"created_at"`
+	// FriendCount is only loaded by GetUserByID
+	FriendCount int `db:"friend_count"`
+
+	EmailVerifiedAt sql.NullTime `db:"email_verified_at"`
+	PhoneVerifiedAt sql.NullTime `db:"phone_verified_at"`
+
+	Username      sql.NullString `db:"username"`
+	Bio           sql.NullString `db:"bio"`
+	CoverImageURL sql.NullString `db:"cover_image_url"`
+	Location      sql.NullString `db:"location"`
+	Website       sql.NullString `db:"website"`
+	Birthday      sql.NullTime   `db:"birthday"`
+
+	// DeletionScheduledAt is set while the account waits to be purged
+	DeletionScheduledAt sql.NullTime `db:"deletion_scheduled_at"`
+
+	// Role decides the permissions put in the user's access tokens
+	Role string `db:"role"`
+
+	// SuspendedUntil and BannedAt are set by moderators, see the admin package
+	SuspendedUntil sql.NullTime `db:"suspended_until"`
+	BannedAt       sql.NullTime `db:"banned_at"`
+}
+
+func (u User) IsBanned() bool {
+	return u.BannedAt.Valid
+}
+
+func (u User) IsSuspended(now time.Time) bool {
+	return u.SuspendedUntil.Valid && u.SuspendedUntil.Time.After(now)
+}
+
+// CredentialHistory keeps the emails and phones a user used before, for account recovery
+type CredentialHistory struct {
+	ID              int          `db:"id"`
+	UserID          string       `db:"user_id"`
+	CredentialType  string       `db:"credential_type"`
+	CredentialValue string       `db:"credential_value"`
+	VerifiedAt      sql.NullTime `db:"verified_at"`
+	ReplacedAt      time.Time    `db:"replaced_at"`
 }
@@ -0,0 +1,508 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/identity"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/role"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/oidc"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// AuthorizeOIDC starts a login through the provider: the client sends the user to the returned URL,
+// and the provider redirects back to the callback with the authorization code
+func (h *userHandler) AuthorizeOIDC(c *fiber.Ctx) error {
+	provider, found := h.oidcProviders[c.Params("provider")]
+	if !found {
+		return config.ErrOIDCProviderNotFound
+	}
+
+	response, err := h.startOIDCAuthorization(c.Context(), provider, "")
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    response,
+	})
+}
+
+// LinkOIDC starts an authorization which links the provider to the logged in user instead of logging in.
+// Once the provider redirects back, the user finishes it with FinishLinkOIDC
+func (h *userHandler) LinkOIDC(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	provider, found := h.oidcProviders[c.Params("provider")]
+	if !found {
+		return config.ErrOIDCProviderNotFound
+	}
+
+	response, err := h.startOIDCAuthorization(c.Context(), provider, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    response,
+	})
+}
+
+func (h *userHandler) startOIDCAuthorization(ctx context.Context, provider *oidc.Provider, userID string) (OIDCAuthorizationResponse, error) {
+	var values [3]string
+	for i := range values {
+		value, err := oidc.RandomString(32)
+		if err != nil {
+			return OIDCAuthorizationResponse{}, errors.Wrap(err, "RandomString error")
+		}
+		values[i] = value
+	}
+
+	now := time.Now().UTC()
+	loginState := identity.LoginState{
+		State:        values[0],
+		Provider:     provider.Name(),
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		UserID:       sql.NullString{String: userID, Valid: userID != ""},
+		ExpiresAt:    now.Add(h.oidcLoginStateExpiry),
+	}
+
+	// fails when the provider cannot be reached, before anything is stored
+	authorizationURL, err := provider.AuthCodeURL(ctx, loginState.State, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		return OIDCAuthorizationResponse{}, errors.Wrap(err, "AuthCodeURL error")
+	}
+
+	err = h.identityRepo.CreateLoginState(ctx, loginState)
+	if err != nil {
+		return OIDCAuthorizationResponse{}, errors.Wrap(err, "CreateLoginState error")
+	}
+
+	// abandoned authorizations are cleaned up along the way, a failure only leaves them for next time
+	if err := h.identityRepo.DeleteExpiredLoginStates(ctx, now); err != nil {
+		log.Println("failed to delete expired oidc login states: ", err)
+	}
+
+	return OIDCAuthorizationResponse{
+		AuthorizationURL: authorizationURL,
+		ExpiresIn:        int(h.oidcLoginStateExpiry.Seconds()),
+	}, nil
+}
+
+// OIDCCallback is where the provider redirects to. It finishes a login started with AuthorizeOIDC
+func (h *userHandler) OIDCCallback(c *fiber.Ctx) error {
+	provider, found := h.oidcProviders[c.Params("provider")]
+	if !found {
+		return config.ErrOIDCProviderNotFound
+	}
+
+	// the user cancelled or the provider refused, e.g. error=access_denied
+	if providerErr := c.Query("error"); providerErr != "" {
+		return errors.Wrap(config.ErrOIDCLoginFailed, providerErr)
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		return config.ErrInvalidOIDCState
+	}
+
+	ctx := c.Context()
+	requestInfo := audit.RequestInfoFrom(c)
+
+	// states started with LinkOIDC do not match here, they are finished with FinishLinkOIDC
+	claims, err := h.finishOIDCAuthorization(ctx, provider, code, state, "")
+	if err != nil {
+		return err
+	}
+
+	user, tokens, err := h.loginWithIdentity(ctx, provider.Name(), claims, requestInfo)
+	if err != nil {
+		reason := ""
+		switch {
+		case err == config.ErrOIDCEmailNotVerified:
+			reason = "email_not_verified"
+		case err == config.ErrOIDCAccountConflict:
+			reason = "identity_conflict"
+		case err == config.ErrAccountBanned:
+			reason = "account_banned"
+		case user.IsSuspended(time.Now().UTC()):
+			reason = "account_suspended"
+		}
+
+		if reason != "" {
+			h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginFailed, user.ID, audit.Details{
+				"method":   "oidc",
+				"provider": provider.Name(),
+				"reason":   reason,
+			})
+		}
+
+		return err
+	}
+
+	if tokens.ChallengeToken != "" {
+		// the login is recorded once the second factor is checked
+		return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+			Message: "two-factor authentication required",
+			Data: TwoFactorChallengeResponse{
+				ChallengeToken: tokens.ChallengeToken,
+				ExpiresIn:      int(twoFactorChallengeExpiry.Seconds()),
+			},
+		})
+	}
+
+	h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginSucceeded, user.ID, audit.Details{
+		"method":   "oidc",
+		"provider": provider.Name(),
+	})
+
+	response := newUserResponse(user)
+	response.AccessToken = tokens.AccessToken
+	response.RefreshToken = tokens.RefreshToken
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "User logged successfully",
+		Data:    response,
+	})
+}
+
+// FinishLinkOIDC finishes a link started with LinkOIDC. The client passes on the code and state the provider
+// redirected with, logged in as the user who started the link: otherwise anyone could start a link to their
+// own account and get someone else to finish it, linking that person's provider account to theirs
+func (h *userHandler) FinishLinkOIDC(c *fiber.Ctx) error {
+	loggedInUser, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	provider, found := h.oidcProviders[c.Params("provider")]
+	if !found {
+		return config.ErrOIDCProviderNotFound
+	}
+
+	var payload FinishOIDCLinkRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	ctx := c.Context()
+	claims, err := h.finishOIDCAuthorization(ctx, provider, payload.Code, payload.State, loggedInUser.UserID)
+	if err != nil {
+		return err
+	}
+
+	linkedIdentity, err := h.linkIdentity(ctx, loggedInUser.UserID, provider.Name(), claims)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventIdentityLinked, loggedInUser.UserID, audit.Details{
+		"provider": provider.Name(),
+		"method":   "manual",
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "provider linked successfully",
+		Data:    newIdentityResponse(linkedIdentity),
+	})
+}
+
+// finishOIDCAuthorization consumes the state of userID, empty for a login, and trades the code for the
+// verified ID token claims
+func (h *userHandler) finishOIDCAuthorization(ctx context.Context, provider *oidc.Provider, code, state, userID string) (oidc.Claims, error) {
+	loginState, err := h.identityRepo.ConsumeLoginState(ctx, state, provider.Name(), userID, time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return oidc.Claims{}, config.ErrInvalidOIDCState
+		}
+		return oidc.Claims{}, errors.Wrap(err, "ConsumeLoginState error")
+	}
+
+	claims, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		// the details are for us, the user can only start over
+		log.Printf("oidc login with %s failed: %s", provider.Name(), err)
+		return claims, config.ErrOIDCLoginFailed
+	}
+
+	return claims, nil
+}
+
+// loginWithIdentity logs in the user linked to the provider account, linking or creating one on the first login
+func (h *userHandler) loginWithIdentity(ctx context.Context, providerName string, claims oidc.Claims, device audit.RequestInfo) (User, AuthTokens, error) {
+	var user User
+
+	userIdentity, err := h.identityRepo.GetIdentityBySubject(ctx, providerName, claims.Subject)
+	switch {
+	case err == nil:
+		user, err = h.userRepo.GetUserByID(ctx, userIdentity.UserID)
+		if err != nil {
+			return user, AuthTokens{}, errors.Wrap(err, "GetUserByID error")
+		}
+
+		if err := h.identityRepo.UpdateLastLogin(ctx, userIdentity.ID, time.Now().UTC()); err != nil {
+			log.Println("failed to update identity last login: ", err)
+		}
+	case err == sql.ErrNoRows:
+		user, err = h.userForNewIdentity(ctx, providerName, claims, device)
+		if err != nil {
+			return user, AuthTokens{}, err
+		}
+	default:
+		return user, AuthTokens{}, errors.Wrap(err, "GetIdentityBySubject error")
+	}
+
+	if err := checkAccountRestriction(user); err != nil {
+		return user, AuthTokens{}, err
+	}
+
+	tokens, err := h.completeLogin(ctx, user, device)
+	if err != nil {
+		return user, AuthTokens{}, err
+	}
+
+	return user, tokens, nil
+}
+
+// userForNewIdentity links the provider account to the user with the same email, or registers a new user.
+// Both sides must have verified the email: otherwise whoever claimed the address first without proving it
+// would take over the other's account, so the user is told to log in and link the provider instead
+func (h *userHandler) userForNewIdentity(ctx context.Context, providerName string, claims oidc.Claims, device audit.RequestInfo) (User, error) {
+	if !claims.HasVerifiedEmail() {
+		return User{}, config.ErrOIDCEmailNotVerified
+	}
+
+	now := time.Now().UTC()
+	newIdentity := identity.Identity{
+		ID:          uuid.NewString(),
+		Provider:    providerName,
+		Subject:     claims.Subject,
+		Email:       sql.NullString{String: claims.Email, Valid: true},
+		LastLoginAt: sql.NullTime{Time: now, Valid: true},
+	}
+
+	user, err := h.userRepo.GetUserByCredential(ctx, "email", claims.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return user, errors.Wrap(err, "GetUserByCredential error")
+	}
+	if err == nil {
+		if !user.EmailVerifiedAt.Valid {
+			return user, config.ErrOIDCAccountConflict
+		}
+
+		newIdentity.UserID = user.ID
+		err = h.identityRepo.CreateIdentity(ctx, nil, newIdentity)
+		if err != nil {
+			// the user already linked another account of this provider
+			if isUniqueViolation(err) {
+				return user, config.ErrOIDCAccountConflict
+			}
+			return user, errors.Wrap(err, "CreateIdentity error")
+		}
+
+		h.auditRecorder.Record(ctx, device, audit.EventIdentityLinked, user.ID, audit.Details{
+			"provider": providerName,
+			"method":   "verified_email",
+		})
+
+		return user, nil
+	}
+
+	// the account has no password, it logs in through the provider until one is set with a password reset
+	user = User{
+		ID:              uuid.NewString(),
+		Name:            oidcDisplayName(claims),
+		Email:           sql.NullString{String: claims.Email, Valid: true},
+		EmailVerifiedAt: sql.NullTime{Time: now, Valid: true},
+		Role:            role.RoleUser,
+	}
+	newIdentity.UserID = user.ID
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return user, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.userRepo.CreateUser(ctx, tx, user)
+	if err != nil {
+		// someone registered the email in the meantime
+		if isUniqueViolation(err) {
+			return user, config.ErrOIDCAccountConflict
+		}
+		return user, errors.Wrap(err, "CreateUser error")
+	}
+
+	err = h.identityRepo.CreateIdentity(ctx, tx, newIdentity)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return user, config.ErrIdentityAlreadyLinked
+		}
+		return user, errors.Wrap(err, "CreateIdentity error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return user, errors.Wrap(err, "Commit error")
+	}
+
+	h.auditRecorder.Record(ctx, device, audit.EventRegister, user.ID, audit.Details{
+		"credentialType": "email",
+		"method":         "oidc",
+		"provider":       providerName,
+	})
+
+	return user, nil
+}
+
+// oidcDisplayName picks the name of a user registered through a provider, falling back to the email's local part
+func oidcDisplayName(claims oidc.Claims) string {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	runes := []rune(name)
+	if len(runes) > 50 {
+		name = string(runes[:50])
+	}
+
+	return name
+}
+
+func (h *userHandler) linkIdentity(ctx context.Context, userID, providerName string, claims oidc.Claims) (identity.Identity, error) {
+	existing, err := h.identityRepo.GetIdentityBySubject(ctx, providerName, claims.Subject)
+	if err != nil && err != sql.ErrNoRows {
+		return existing, errors.Wrap(err, "GetIdentityBySubject error")
+	}
+	if err == nil {
+		if existing.UserID != userID {
+			return existing, config.ErrIdentityAlreadyLinked
+		}
+
+		// linking twice is harmless
+		return existing, nil
+	}
+
+	newIdentity := identity.Identity{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Provider:  providerName,
+		Subject:   claims.Subject,
+		Email:     sql.NullString{String: claims.Email, Valid: claims.Email != ""},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = h.identityRepo.CreateIdentity(ctx, nil, newIdentity)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return newIdentity, config.ErrProviderAlreadyLinked
+		}
+		return newIdentity, errors.Wrap(err, "CreateIdentity error")
+	}
+
+	return newIdentity, nil
+}
+
+func (h *userHandler) UnlinkOIDC(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	// a provider removed from the configuration can still be unlinked
+	ctx := c.Context()
+	providerName := c.Params("provider")
+	err = h.unlinkIdentity(ctx, claims.UserID, providerName)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventIdentityUnlinked, claims.UserID, audit.Details{
+		"provider": providerName,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "provider unlinked successfully",
+	})
+}
+
+func (h *userHandler) unlinkIdentity(ctx context.Context, userID, providerName string) error {
+	user, err := h.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "GetUserByID error")
+	}
+
+	identities, err := h.identityRepo.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "ListUserIdentities error")
+	}
+
+	linked := false
+	for _, userIdentity := range identities {
+		if userIdentity.Provider == providerName {
+			linked = true
+			break
+		}
+	}
+	if !linked {
+		return config.ErrIdentityNotFound
+	}
+
+	// users registered through a provider have no password, they would be locked out
+	if user.Password == "" && len(identities) == 1 {
+		return config.ErrCannotUnlinkLastLogin
+	}
+
+	err = h.identityRepo.DeleteIdentity(ctx, nil, userID, providerName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrIdentityNotFound
+		}
+		return errors.Wrap(err, "DeleteIdentity error")
+	}
+
+	return nil
+}
+
+func (h *userHandler) ListIdentities(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	identities, err := h.identityRepo.ListUserIdentities(c.Context(), claims.UserID)
+	if err != nil {
+		return errors.Wrap(err, "ListUserIdentities error")
+	}
+
+	responses := []IdentityResponse{}
+	for _, userIdentity := range identities {
+		responses = append(responses, newIdentityResponse(userIdentity))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    responses,
+	})
+}
@@ -0,0 +1,266 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// password length limits, following NIST SP 800-63B: long passphrases are allowed and nothing
+// else is imposed on the composition
+const (
+	PasswordMinLength = 8
+	PasswordMaxLength = 128
+)
+
+// bcrypt only uses the first 72 bytes of a password, which multibyte characters reach well
+// before PasswordMaxLength
+const bcryptMaxPasswordBytes = 72
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+	ErrPasswordTooLong     = errors.New("password is longer than the hasher accepts")
+)
+
+// PasswordHasher hashes passwords and checks them against stored hashes
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch when password does not produce hash
+	Verify(hash, password string) error
+	// Recognizes reports whether hash was produced by this hasher's algorithm
+	Recognizes(hash string) bool
+	// NeedsRehash reports whether hash should be replaced by one made with the current parameters
+	NeedsRehash(hash string) bool
+	// MaxPasswordBytes is the length of the longest password Hash accepts, 0 when there is no limit
+	MaxPasswordBytes() int
+}
+
+// Argon2idParams are the cost parameters of argon2id. The defaults follow the OWASP password storage cheat sheet
+type Argon2idParams struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	if params.SaltLength == 0 {
+		params.SaltLength = 16
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = 32
+	}
+
+	return &Argon2idHasher{params: params}
+}
+
+// Hash returns the PHC string of password, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(hash, password string) error {
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+func (h *Argon2idHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, _, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		params.KeyLength != h.params.KeyLength ||
+		uint32(len(salt)) != h.params.SaltLength
+}
+
+func (h *Argon2idHasher) MaxPasswordBytes() int {
+	return 0
+}
+
+func decodeArgon2idHash(hash string) (Argon2idParams, []byte, []byte, error) {
+	var (
+		params  Argon2idParams
+		version int
+	)
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	params.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	// the bytes past the limit would be silently ignored
+	if len(password) > bcryptMaxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+
+	return err
+}
+
+func (h *BcryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+func (h *BcryptHasher) MaxPasswordBytes() int {
+	return bcryptMaxPasswordBytes
+}
+
+// MultiHasher hashes with the current hasher and still verifies hashes made by the legacy ones,
+// so stored hashes can be upgraded one login at a time
+type MultiHasher struct {
+	current PasswordHasher
+	legacy  []PasswordHasher
+}
+
+func NewMultiHasher(current PasswordHasher, legacy ...PasswordHasher) *MultiHasher {
+	return &MultiHasher{
+		current: current,
+		legacy:  legacy,
+	}
+}
+
+func (h *MultiHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *MultiHasher) Verify(hash, password string) error {
+	hasher := h.find(hash)
+	if hasher == nil {
+		return ErrUnknownPasswordHash
+	}
+
+	return hasher.Verify(hash, password)
+}
+
+func (h *MultiHasher) Recognizes(hash string) bool {
+	return h.find(hash) != nil
+}
+
+// NeedsRehash is true for every hash not made by the current hasher with its current parameters
+func (h *MultiHasher) NeedsRehash(hash string) bool {
+	if !h.current.Recognizes(hash) {
+		return true
+	}
+
+	return h.current.NeedsRehash(hash)
+}
+
+// MaxPasswordBytes is the limit of the current hasher, the legacy ones only verify
+func (h *MultiHasher) MaxPasswordBytes() int {
+	return h.current.MaxPasswordBytes()
+}
+
+func (h *MultiHasher) find(hash string) PasswordHasher {
+	if h.current.Recognizes(hash) {
+		return h.current
+	}
+
+	for _, hasher := range h.legacy {
+		if hasher.Recognizes(hash) {
+			return hasher
+		}
+	}
+
+	return nil
+}
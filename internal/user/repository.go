@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/phone"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -16,12 +19,12 @@ func NewUserRepo(db *sqlx.DB) UserRepo {
 	return UserRepo{db: db}
 }
 
-func (r *UserRepo) CreateUser(ctx context.Context, user User) error {
+func (r *UserRepo) CreateUser(ctx context.Context, tx *sql.Tx, user User) error {
 	query := `
 		INSERT INTO users
-			(id, email, phone, name, password)
+			(id, email, phone, name, password, email_verified_at)
 		VALUES
-			(:id, :email, :phone, :name, :password)
+			(:id, :email, :phone, :name, :password, :email_verified_at)
 	`
 
 	updatedQuery, args, err := sqlx.Named(query, user)
@@ -30,7 +33,11 @@ func (r *UserRepo) CreateUser(ctx context.Context, user User) error {
 	}
 
 	// since we won't be using the returned data, leave it blank
-	_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
 	if err != nil {
 		return err
 	}
@@ -47,7 +54,13 @@ func (r *UserRepo) GetUserByCredential(ctx context.Context, credentialType, cred
 			email,
 			phone,
 			name,
-			password
+			password,
+			email_verified_at,
+			phone_verified_at,
+			deletion_scheduled_at,
+			role,
+			suspended_until,
+			banned_at
 		FROM
 			users
 		WHERE
@@ -55,14 +68,28 @@ func (r *UserRepo) GetUserByCredential(ctx context.Context, credentialType, cred
 		LIMIT 1
 	`
 
-	var query string
 	if credentialType == "email" {
-		query = fmt.Sprintf(rawQuery, "email")
-	} else {
-		query = fmt.Sprintf(rawQuery, "phone")
+		err := r.db.GetContext(ctx, &result, fmt.Sprintf(rawQuery, "email"), credentialValue)
+		if err != nil {
+			return result, err
+		}
+
+		return result, nil
+	}
+
+	// phones are stored in E.164, a value which does not parse is looked up as given
+	query := fmt.Sprintf(rawQuery, "phone")
+	number, err := phone.Normalize(credentialValue)
+	if err != nil {
+		number = credentialValue
 	}
 
-	err := r.db.GetContext(ctx, &result, query, credentialValue)
+	err = r.db.GetContext(ctx, &result, query, number)
+	if err == sql.ErrNoRows && number != credentialValue {
+		// phones stored before they were normalized keep the form they were registered with
+		// until the normalize-phones command rewrites them
+		err = r.db.GetContext(ctx, &result, query, credentialValue)
+	}
 	if err != nil {
 		return result, err
 	}
@@ -80,7 +107,21 @@ func (r *UserRepo) GetUserByID(ctx context.Context, id string) (User, error) {
 			phone,
 			name,
 			password,
-			image_url
+			image_url,
+			email_verified_at,
+			phone_verified_at,
+			bio,
+			cover_image_url,
+			location,
+			website,
+			username,
+			birthday,
+			deletion_scheduled_at,
+			role,
+			suspended_until,
+			banned_at,
+			friend_count,
+			created_at
 		FROM
 			users
 		WHERE
@@ -96,15 +137,59 @@ func (r *UserRepo) GetUserByID(ctx context.Context, id string) (User, error) {
 	return result, nil
 }
 
-func (r *UserRepo) UpdateUser(ctx context.Context, tx *sql.Tx, user User) error {
+// GetUserByUsername finds a user by handle, ignoring case
+func (r *UserRepo) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	var result User
+
+	query := `
+		SELECT
+			id,
+			email,
+			phone,
+			name,
+			password,
+			image_url,
+			email_verified_at,
+			phone_verified_at,
+			bio,
+			cover_image_url,
+			location,
+			website,
+			username,
+			birthday,
+			deletion_scheduled_at,
+			role,
+			suspended_until,
+			banned_at,
+			friend_count,
+			created_at
+		FROM
+			users
+		WHERE
+			LOWER(username) = LOWER($1)
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, username)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// UpdateCredentials writes the user's email and phone along with their verification times.
+// Profile fields are left alone, they are changed by UpdateProfile
+func (r *UserRepo) UpdateCredentials(ctx context.Context, tx *sql.Tx, user User) error {
 	query := `
 		UPDATE
 			users
 		SET
 			email = :email,
 			phone = :phone,
-			image_url = :image_url,
-			name = :name
+			email_verified_at = :email_verified_at,
+			phone_verified_at = :phone_verified_at,
+			updated_at = NOW()
 		WHERE
 			id = :id
 	`
@@ -126,6 +211,233 @@ func (r *UserRepo) UpdateUser(ctx context.Context, tx *sql.Tx, user User) error
 	return nil
 }
 
+// profileColumns are the columns UpdateProfile may change, in the order they are set
+var profileColumns = []string{
+	"name",
+	"username",
+	"image_url",
+	"bio",
+	"cover_image_url",
+	"location",
+	"website",
+	"birthday",
+}
+
+// UpdateProfile only sets the profile columns present in changes, keyed by column name.
+// Credentials are never written here, so a profile update cannot race a credential change
+func (r *UserRepo) UpdateProfile(ctx context.Context, tx *sql.Tx, userID string, changes map[string]interface{}) error {
+	sets := []string{}
+	args := []interface{}{}
+	for _, column := range profileColumns {
+		value, ok := changes[column]
+		if !ok {
+			continue
+		}
+
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE
+			users
+		SET
+			%s,
+			updated_at = NOW()
+		WHERE
+			id = ?
+	`, strings.Join(sets, ",\n\t\t\t"))
+	args = append(args, userID)
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, tx *sql.Tx, userID, hashedPassword string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			password = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, hashedPassword)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, hashedPassword)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdatePasswordIfUnchanged replaces the hash only while the stored one is still currentHash, so it
+// cannot undo a password change committed in the meantime. Nothing is updated otherwise
+func (r *UserRepo) UpdatePasswordIfUnchanged(ctx context.Context, tx *sql.Tx, userID, currentHash, hashedPassword string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			password = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+			AND password = $3
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, hashedPassword, currentHash)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, hashedPassword, currentHash)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListUsersWithPhone returns the id and phone of every user having a phone
+func (r *UserRepo) ListUsersWithPhone(ctx context.Context) ([]User, error) {
+	users := []User{}
+
+	query := `
+		SELECT
+			id,
+			phone
+		FROM
+			users
+		WHERE
+			phone IS NOT NULL
+		ORDER BY
+			created_at ASC
+	`
+
+	err := r.db.SelectContext(ctx, &users, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *UserRepo) UpdatePhone(ctx context.Context, tx *sql.Tx, userID, phoneNumber string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			phone = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, phoneNumber)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, phoneNumber)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ScheduleDeletion marks the account to be purged at deleteAt, unless the user logs in before then
+func (r *UserRepo) ScheduleDeletion(ctx context.Context, tx *sql.Tx, userID string, deleteAt time.Time) error {
+	query := `
+		UPDATE
+			users
+		SET
+			deletion_scheduled_at = $2,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, deleteAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, deleteAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *UserRepo) CancelDeletion(ctx context.Context, tx *sql.Tx, userID string) error {
+	query := `
+		UPDATE
+			users
+		SET
+			deletion_scheduled_at = NULL,
+			updated_at = NOW()
+		WHERE
+			id = $1
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *UserRepo) CreateCredentialHistory(ctx context.Context, tx *sql.Tx, history CredentialHistory) error {
+	query := `
+		INSERT INTO user_credential_history
+			(user_id, credential_type, credential_value, verified_at)
+		VALUES
+			(:user_id, :credential_type, :credential_value, :verified_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, history)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (r *UserRepo) IncrementFriendCounter(ctx context.Context, tx *sql.Tx, userID, friendID string) error {
 	query := `
 		UPDATE	
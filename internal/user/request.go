@@ -1,307 +1,234 @@
 package user
 
 import (
+	"fmt"
 	"net/mail"
-	"regexp"
+	"strings"
+	"time"
 
-	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/handle"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/phone"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
 )
 
 func (r *RegisterUserRequest) Validate() error {
-	var validationErrs config.ValidationErrors
+	var validationErrs validation.Errors
 
 	// validate credential type
 	if r.CredentialType == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "credentialType",
-			Message: "required",
-		})
+		validationErrs.Add("credentialType", "required", "is required")
 	} else if r.CredentialType != "email" && r.CredentialType != "phone" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "credentialType",
-			Message: "unaccepted value",
-		})
+		validationErrs.Add("credentialType", "oneof", "must be one of: email, phone")
 	}
 
 	// validate credential value
 	if r.CredentialValue == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "credentialValue",
-			Message: "required",
-		})
+		validationErrs.Add("credentialValue", "required", "is required")
 	} else {
 		if r.CredentialType == "email" {
 			email := r.CredentialValue
 
 			// do email validation
 			if _, err := mail.ParseAddress(email); err != nil {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "is not a valid email format",
-				})
+				validationErrs.Add("credentialValue", "email", "is not a valid email format")
 			}
 
 			if len(r.CredentialValue) < 5 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is less than 5",
-				})
+				validationErrs.Add("credentialValue", "min", "must be at least 5 characters")
 			}
 
 			if len(r.CredentialValue) > 50 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is more than 50",
-				})
+				validationErrs.Add("credentialValue", "max", "must be at most 50 characters")
 			}
 		} else if r.CredentialType == "phone" {
-			phone := r.CredentialValue
-
-			// do email validation
-			pat := regexp.MustCompile(`^\+(\d)+$`)
-			if !pat.MatchString(phone) {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "is not a valid phone format",
-				})
-			}
-
-			if len(r.CredentialValue) < 7 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is less than 7",
-				})
-			}
-
-			if len(r.CredentialValue) > 13 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is more than 13",
-				})
+			// phones are stored and looked up in E.164, whatever way they were typed in
+			number, err := phone.Normalize(r.CredentialValue)
+			if err != nil {
+				validationErrs.Add("credentialValue", "phone", err.Error())
+			} else {
+				r.CredentialValue = number
 			}
 		}
 	}
 
 	// validate name
 	if r.Name == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "name",
-			Message: "required",
-		})
+		validationErrs.Add("name", "required", "is required")
 	} else {
 		if len(r.Name) < 5 {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "name",
-				Message: "length is less than 5",
-			})
+			validationErrs.Add("name", "min", "must be at least 5 characters")
 		}
 		if len(r.Name) > 50 {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "name",
-				Message: "length is more than 50",
-			})
+			validationErrs.Add("name", "max", "must be at most 50 characters")
 		}
 	}
 
 	// validate password
 	if r.Password == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "password",
-			Message: "required",
-		})
+		validationErrs.Add("password", "required", "is required")
 	} else {
-		if len(r.Password) < 5 {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "password",
-				Message: "length is less than 5",
-			})
+		if len(r.Password) < PasswordMinLength {
+			validationErrs.Add("password", "min", fmt.Sprintf("must be at least %d characters", PasswordMinLength))
 		}
-		if len(r.Password) > 15 {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "password",
-				Message: "length is more than 15",
-			})
+		if len(r.Password) > PasswordMaxLength {
+			validationErrs.Add("password", "max", fmt.Sprintf("must be at most %d characters", PasswordMaxLength))
 		}
 	}
 
-	if validationErrs == nil {
-		return nil
-	} else {
-		return &validationErrs
-	}
+	return validationErrs.Err()
 }
 
 func (r *AuthenticateRequest) Validate() error {
-	var validationErrs config.ValidationErrors
+	var validationErrs validation.Errors
 
 	// validate credential type
 	if r.CredentialType == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "credentialType",
-			Message: "required",
-		})
+		validationErrs.Add("credentialType", "required", "is required")
 	} else if r.CredentialType != "email" && r.CredentialType != "phone" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "credentialType",
-			Message: "unaccepted value",
-		})
+		validationErrs.Add("credentialType", "oneof", "must be one of: email, phone")
 	}
 
 	// validate credential value
 	if r.CredentialValue == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "credentialValue",
-			Message: "required",
-		})
+		validationErrs.Add("credentialValue", "required", "is required")
 	} else {
 		if r.CredentialType == "email" {
 			email := r.CredentialValue
 
 			// do email validation
 			if _, err := mail.ParseAddress(email); err != nil {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "is not a valid email format",
-				})
+				validationErrs.Add("credentialValue", "email", "is not a valid email format")
 			}
 
 			if len(r.CredentialValue) < 5 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is less than 5",
-				})
+				validationErrs.Add("credentialValue", "min", "must be at least 5 characters")
 			}
 
 			if len(r.CredentialValue) > 30 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is more than 30",
-				})
+				validationErrs.Add("credentialValue", "max", "must be at most 30 characters")
 			}
 		} else if r.CredentialType == "phone" {
-			phone := r.CredentialValue
-
-			// do email validation
-			pat := regexp.MustCompile(`^\+(\d)+$`)
-			if !pat.MatchString(phone) {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "is not a valid phone format",
-				})
-			}
-
-			if len(r.CredentialValue) < 7 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is less than 7",
-				})
-			}
-
-			if len(r.CredentialValue) > 13 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is more than 13",
-				})
+			// kept as typed, so accounts whose phone was stored before phones were normalized
+			// can still log in with it. The repository looks the normalized form up first
+			if _, err := phone.Normalize(r.CredentialValue); err != nil {
+				validationErrs.Add("credentialValue", "phone", err.Error())
 			}
 		}
 	}
 
 	// validate password
 	if r.Password == "" {
-		validationErrs = append(validationErrs, config.ValidationError{
-			Field:   "password",
-			Message: "required",
-		})
+		validationErrs.Add("password", "required", "is required")
 	} else {
-		if len(r.Password) < 5 {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "password",
-				Message: "length is less than 5",
-			})
-		}
-		if len(r.Password) > 15 {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "password",
-				Message: "length is more than 15",
-			})
+		// no minimum here, passwords set before the current limits must keep working
+		if len(r.Password) > PasswordMaxLength {
+			validationErrs.Add("password", "max", fmt.Sprintf("must be at most %d characters", PasswordMaxLength))
 		}
 	}
 
-	if validationErrs == nil {
-		return nil
-	} else {
-		return &validationErrs
-	}
+	return validationErrs.Err()
 }
 
 func (r *LinkCredentialRequest) Validate() error {
-	var validationErrs config.ValidationErrors
+	var validationErrs validation.Errors
 
 	// validate credential type
 	if r.CredentialType == "email" {
 		if r.Email == "" {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "email",
-				Message: "required",
-			})
+			validationErrs.Add("email", "required", "is required")
 		} else {
 			// do email validation
 			if _, err := mail.ParseAddress(r.Email); err != nil {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "is not a valid email format",
-				})
+				validationErrs.Add("email", "email", "is not a valid email format")
 			}
 
 			if len(r.Email) < 5 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is less than 5",
-				})
+				validationErrs.Add("email", "min", "must be at least 5 characters")
 			}
 
 			if len(r.Email) > 30 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is more than 30",
-				})
+				validationErrs.Add("email", "max", "must be at most 30 characters")
 			}
 		}
 	} else if r.CredentialType == "phone" {
 		if r.Phone == "" {
-			validationErrs = append(validationErrs, config.ValidationError{
-				Field:   "phone",
-				Message: "required",
-			})
+			validationErrs.Add("phone", "required", "is required")
 		} else {
-			// do phone validation
-			pat := regexp.MustCompile(`^\+(\d)+$`)
-			if !pat.MatchString(r.Phone) {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "is not a valid phone format",
-				})
+			number, err := phone.Normalize(r.Phone)
+			if err != nil {
+				validationErrs.Add("phone", "phone", err.Error())
+			} else {
+				r.Phone = number
 			}
+		}
+	}
 
-			if len(r.Phone) < 7 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is less than 7",
-				})
-			}
+	return validationErrs.Err()
+}
 
-			if len(r.Phone) > 13 {
-				validationErrs = append(validationErrs, config.ValidationError{
-					Field:   "credentialValue",
-					Message: "length is more than 13",
-				})
-			}
+// Validate checks what the struct tags cannot express. It expects the tags to be validated first
+func (r *UpdateUserRequest) Validate() error {
+	var validationErrs validation.Errors
+
+	if r.ImageURL == nil && r.Name == nil && r.Username == nil && r.Bio == nil && r.CoverImageURL == nil &&
+		r.Location == nil && r.Website == nil && r.Birthday == nil {
+		validationErrs.Add("body", "required", "at least one field is required")
+	}
+
+	if r.Username != nil {
+		if err := handle.Validate(*r.Username); err != nil {
+			validationErrs.Add("username", "username", err.Error())
 		}
 	}
 
-	if validationErrs == nil {
-		return nil
-	} else {
-		return &validationErrs
+	// uploaded images always have an extension
+	if r.ImageURL != nil && !hasFileExtension(*r.ImageURL) {
+		validationErrs.Add("imageUrl", "image_url", "is not an image URL")
+	}
+	if r.CoverImageURL != nil && *r.CoverImageURL != "" && !hasFileExtension(*r.CoverImageURL) {
+		validationErrs.Add("coverImageUrl", "image_url", "is not an image URL")
+	}
+
+	if r.Birthday != nil && *r.Birthday != "" {
+		birthday, _ := time.Parse("2006-01-02", *r.Birthday)
+		if birthday.After(time.Now().UTC()) {
+			validationErrs.Add("birthday", "past", "is in the future")
+		} else if birthday.Year() < 1900 {
+			validationErrs.Add("birthday", "min", "is before 1900")
+		}
 	}
+
+	return validationErrs.Err()
+}
+
+// PresentFields lists the JSON names of the fields the request changes
+func (r *UpdateUserRequest) PresentFields() []string {
+	fields := []string{}
+	present := []struct {
+		name    string
+		present bool
+	}{
+		{"imageUrl", r.ImageURL != nil},
+		{"name", r.Name != nil},
+		{"username", r.Username != nil},
+		{"bio", r.Bio != nil},
+		{"coverImageUrl", r.CoverImageURL != nil},
+		{"location", r.Location != nil},
+		{"website", r.Website != nil},
+		{"birthday", r.Birthday != nil},
+	}
+	for _, field := range present {
+		if field.present {
+			fields = append(fields, field.name)
+		}
+	}
+
+	return fields
+}
+
+func hasFileExtension(url string) bool {
+	comps := strings.Split(url, "/")
+	filename := comps[len(comps)-1]
+
+	return len(strings.Split(filename, ".")) >= 2
 }
@@ -1,15 +1,115 @@
 package user
 
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/identity"
+)
+
 type UserRegisterResponse struct {
-	Email       string `json:"email,omitempty"`
-	Phone       string `json:"phone,omitempty"`
-	Name        string `json:"name"`
-	AccessToken string `json:"accessToken"`
+	Email        string `json:"email,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Name         string `json:"name"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 type UserResponse struct {
-	Email       string `json:"email"`
-	Phone       string `json:"phone"`
-	Name        string `json:"name"`
-	AccessToken string `json:"accessToken,omitempty"`
+	Email           string     `json:"email"`
+	Phone           string     `json:"phone"`
+	Name            string     `json:"name"`
+	Username        string     `json:"username"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	PhoneVerifiedAt *time.Time `json:"phoneVerifiedAt"`
+	ImageURL        string     `json:"imageUrl"`
+	Bio             string     `json:"bio"`
+	CoverImageURL   string     `json:"coverImageUrl"`
+	Location        string     `json:"location"`
+	Website         string     `json:"website"`
+	Birthday        *string    `json:"birthday"`
+	AccessToken     string     `json:"accessToken,omitempty"`
+	RefreshToken    string     `json:"refreshToken,omitempty"`
+}
+
+func newUserResponse(user User) UserResponse {
+	return UserResponse{
+		Email:           user.Email.String,
+		Phone:           user.Phone.String,
+		Name:            user.Name,
+		Username:        user.Username.String,
+		EmailVerifiedAt: nullTimeToPtr(user.EmailVerifiedAt),
+		PhoneVerifiedAt: nullTimeToPtr(user.PhoneVerifiedAt),
+		ImageURL:        user.ImageURL.String,
+		Bio:             user.Bio.String,
+		CoverImageURL:   user.CoverImageURL.String,
+		Location:        user.Location.String,
+		Website:         user.Website.String,
+		Birthday:        FormatBirthday(user.Birthday),
+	}
+}
+
+// FormatBirthday formats the date as YYYY-MM-DD, the format it is submitted in
+func FormatBirthday(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+
+	birthday := t.Time.Format("2006-01-02")
+	return &birthday
+}
+
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TwoFactorChallengeResponse struct {
+	ChallengeToken string `json:"challengeToken"`
+	// ExpiresIn is the challenge token lifetime in seconds
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type TwoFactorRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type AccountDeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
+
+type OIDCAuthorizationResponse struct {
+	// AuthorizationURL is where the user signs in at the provider, which then redirects to the callback
+	AuthorizationURL string `json:"authorizationUrl"`
+	// ExpiresIn is how long the user has to finish signing in, in seconds
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type IdentityResponse struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+func newIdentityResponse(userIdentity identity.Identity) IdentityResponse {
+	return IdentityResponse{
+		Provider:    userIdentity.Provider,
+		Email:       userIdentity.Email.String,
+		CreatedAt:   userIdentity.CreatedAt,
+		LastLoginAt: nullTimeToPtr(userIdentity.LastLoginAt),
+	}
 }
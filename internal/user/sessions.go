@@ -0,0 +1,94 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/session"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// ListSessions lists the devices the user is currently signed in from
+func (h *userHandler) ListSessions(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	responses, err := h.listSessions(c.Context(), claims)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "success",
+		Data:    responses,
+	})
+}
+
+func (h *userHandler) listSessions(ctx context.Context, claims jwt.JWTUser) ([]session.SessionResponse, error) {
+	sessions, err := h.sessionRepo.ListActiveSessions(ctx, claims.UserID, time.Now().UTC())
+	if err != nil {
+		return nil, errors.Wrap(err, "ListActiveSessions error")
+	}
+
+	responses := []session.SessionResponse{}
+	for _, userSession := range sessions {
+		responses = append(responses, session.NewSessionResponse(userSession, claims.SessionID))
+	}
+
+	return responses, nil
+}
+
+// RevokeSession signs the user out of one device. Access tokens of the session are rejected
+// right away, and its refresh token cannot be used anymore
+func (h *userHandler) RevokeSession(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	ctx := c.Context()
+	sessionID := c.Params("sessionId")
+	err = h.revokeSession(ctx, claims.UserID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, audit.RequestInfoFrom(c), audit.EventTokensRevoked, claims.UserID, audit.Details{
+		"reason":    "session_revoked",
+		"sessionId": sessionID,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "session revoked successfully",
+	})
+}
+
+func (h *userHandler) revokeSession(ctx context.Context, userID, sessionID string) error {
+	userSession, err := h.sessionRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return config.ErrSessionNotFound
+		}
+		return errors.Wrap(err, "GetSession error")
+	}
+
+	// sessions of other users are reported as missing so their IDs cannot be probed
+	if userSession.UserID != userID || userSession.RevokedAt.Valid {
+		return config.ErrSessionNotFound
+	}
+
+	err = h.revoker.RevokeSession(ctx, userSession.ID)
+	if err != nil {
+		return errors.Wrap(err, "RevokeSession error")
+	}
+
+	return nil
+}
@@ -0,0 +1,470 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/audit"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/model"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/session"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/twofactor"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/encryption"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/token"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/totp"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/validation"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	totpIssuer = "Segokuning"
+	// totpSkew accepts the codes of the previous and next step to tolerate clock drift
+	totpSkew = 1
+	// twoFactorChallengeExpiry is how long the user has to enter the code after the password step
+	twoFactorChallengeExpiry = 5 * time.Minute
+	// recoveryCodeLength is the number of base32 characters of a recovery code, shown as XXXXX-XXXXX
+	recoveryCodeLength = 10
+)
+
+func (h *userHandler) EnrollTwoFactor(c *fiber.Ctx) error {
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+
+	response, err := h.enrollTwoFactor(c.Context(), claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "scan the provisioning URI with an authenticator app, then confirm with a code",
+		Data:    response,
+	})
+}
+
+func (h *userHandler) enrollTwoFactor(ctx context.Context, userID string) (TwoFactorEnrollResponse, error) {
+	user, err := h.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return TwoFactorEnrollResponse{}, errors.Wrap(err, "GetUserByID error")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TwoFactorEnrollResponse{}, errors.Wrap(err, "totp.GenerateSecret error")
+	}
+
+	encryptedSecret, err := h.totpCipher.Encrypt(secret, userID)
+	if err != nil {
+		return TwoFactorEnrollResponse{}, errors.Wrap(err, "Encrypt error")
+	}
+
+	stored, err := h.twoFactorRepo.UpsertPendingTOTP(ctx, nil, userID, encryptedSecret, time.Now().UTC())
+	if err != nil {
+		return TwoFactorEnrollResponse{}, errors.Wrap(err, "UpsertPendingTOTP error")
+	}
+	if !stored {
+		return TwoFactorEnrollResponse{}, config.ErrTwoFactorAlreadyEnabled
+	}
+
+	accountName := user.Email.String
+	if accountName == "" {
+		accountName = user.Phone.String
+	}
+
+	return TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, accountName, secret),
+	}, nil
+}
+
+func (h *userHandler) ConfirmTwoFactor(c *fiber.Ctx) error {
+	var payload ConfirmTwoFactorRequest
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	recoveryCodes, err := h.confirmTwoFactor(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "two-factor authentication enabled, store the recovery codes somewhere safe",
+		Data: TwoFactorRecoveryCodesResponse{
+			RecoveryCodes: recoveryCodes,
+		},
+	})
+}
+
+func (h *userHandler) confirmTwoFactor(ctx context.Context, payload ConfirmTwoFactorRequest) ([]string, error) {
+	enrollment, err := h.getTOTP(ctx, payload.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, config.ErrTwoFactorNotEnrolled
+		}
+
+		return nil, err
+	}
+	if enrollment.Enabled() {
+		return nil, config.ErrTwoFactorAlreadyEnabled
+	}
+
+	now := time.Now().UTC()
+	step, valid := totp.Validate(enrollment.Secret, payload.Code, now, totpSkew)
+	if !valid {
+		return nil, config.ErrInvalidTwoFactorCode
+	}
+
+	rawCodes, recoveryCodes, err := generateRecoveryCodes(payload.UserID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.twoFactorRepo.ConfirmTOTP(ctx, tx, payload.UserID, step, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "ConfirmTOTP error")
+	}
+
+	err = h.twoFactorRepo.DeleteRecoveryCodes(ctx, tx, payload.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "DeleteRecoveryCodes error")
+	}
+
+	err = h.twoFactorRepo.CreateRecoveryCodes(ctx, tx, recoveryCodes)
+	if err != nil {
+		return nil, errors.Wrap(err, "CreateRecoveryCodes error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "Commit error")
+	}
+
+	return rawCodes, nil
+}
+
+func (h *userHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	var payload DisableTwoFactorRequest
+
+	claims, err := jwt.GetLoggedInUser(c)
+	if err != nil {
+		return config.ErrRequestForbidden
+	}
+	payload.UserID = claims.UserID
+
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	err = h.disableTwoFactor(c.Context(), payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "two-factor authentication disabled",
+	})
+}
+
+func (h *userHandler) disableTwoFactor(ctx context.Context, payload DisableTwoFactorRequest) error {
+	user, err := h.userRepo.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return errors.Wrap(err, "GetUserByID error")
+	}
+
+	if err := h.passwordHasher.Verify(user.Password, payload.Password); err != nil {
+		return config.ErrWrongPassword
+	}
+
+	enrollment, err := h.getTOTP(ctx, payload.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == sql.ErrNoRows || !enrollment.Enabled() {
+		return config.ErrTwoFactorNotEnrolled
+	}
+
+	err = h.verifySecondFactor(ctx, enrollment, payload.Code)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.twoFactorRepo.DeleteTOTP(ctx, tx, payload.UserID)
+	if err != nil {
+		return errors.Wrap(err, "DeleteTOTP error")
+	}
+
+	err = h.twoFactorRepo.DeleteRecoveryCodes(ctx, tx, payload.UserID)
+	if err != nil {
+		return errors.Wrap(err, "DeleteRecoveryCodes error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "Commit error")
+	}
+
+	return nil
+}
+
+func (h *userHandler) AuthenticateTwoFactor(c *fiber.Ctx) error {
+	var payload TwoFactorLoginRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return errors.Wrap(config.ErrMalformedRequest, err.Error())
+	}
+
+	if err := validation.Validate(payload); err != nil {
+		return err
+	}
+
+	claims, err := h.jwtProvider.ParseToken(payload.ChallengeToken, jwt.TokenTypeTwoFactorChallenge)
+	if err != nil {
+		return err
+	}
+	userID, _ := claims["userId"].(string)
+	challengeID, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if userID == "" || challengeID == "" || err != nil || expiresAt == nil {
+		return jwt.ErrInvalidToken
+	}
+	challenge := session.RevokedAccessToken{
+		JTI:       challengeID,
+		UserID:    userID,
+		ExpiresAt: expiresAt.Time,
+	}
+
+	// the challenge token lives for minutes, so code guesses are throttled like password guesses
+	ctx := c.Context()
+	guardKey := "2fa:" + userID
+
+	retryAfter, err := h.loginGuard.Check(ctx, guardKey, c.IP())
+	if err != nil {
+		return errors.Wrap(err, "loginGuard.Check error")
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return config.ErrTooManyLoginAttempts
+	}
+
+	requestInfo := audit.RequestInfoFrom(c)
+	user, tokens, err := h.authenticateTwoFactor(ctx, challenge, payload.Code, requestInfo)
+	if err != nil {
+		if err == config.ErrInvalidTwoFactorCode {
+			if guardErr := h.loginGuard.RecordFailure(ctx, "wrong_2fa_code", guardKey, c.IP()); guardErr != nil {
+				return errors.Wrap(guardErr, "loginGuard.RecordFailure error")
+			}
+
+			h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginFailed, userID, audit.Details{
+				"reason": "wrong_2fa_code",
+			})
+		}
+
+		return err
+	}
+
+	h.auditRecorder.Record(ctx, requestInfo, audit.EventLoginSucceeded, user.ID, audit.Details{
+		"method": "2fa",
+	})
+
+	err = h.loginGuard.RecordSuccess(ctx, guardKey)
+	if err != nil {
+		return errors.Wrap(err, "loginGuard.RecordSuccess error")
+	}
+
+	response := newUserResponse(user)
+	response.AccessToken = tokens.AccessToken
+	response.RefreshToken = tokens.RefreshToken
+
+	return c.Status(fiber.StatusOK).JSON(model.DataResponse{
+		Message: "User logged successfully",
+		Data:    response,
+	})
+}
+
+// authenticateTwoFactor exchanges a challenge and a code for tokens, and each challenge can be exchanged once
+func (h *userHandler) authenticateTwoFactor(ctx context.Context, challenge session.RevokedAccessToken, code string, device audit.RequestInfo) (User, AuthTokens, error) {
+	userID := challenge.UserID
+
+	// reject a replayed challenge before it can spend a code
+	redeemed, err := h.sessionRepo.IsAccessTokenRevoked(ctx, challenge.JTI)
+	if err != nil {
+		return User{}, AuthTokens{}, errors.Wrap(err, "IsAccessTokenRevoked error")
+	}
+	if redeemed {
+		return User{}, AuthTokens{}, jwt.ErrInvalidToken
+	}
+
+	enrollment, err := h.getTOTP(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return User{}, AuthTokens{}, err
+	}
+	// 2FA was disabled after the challenge was issued
+	if err == sql.ErrNoRows || !enrollment.Enabled() {
+		return User{}, AuthTokens{}, jwt.ErrInvalidToken
+	}
+
+	err = h.verifySecondFactor(ctx, enrollment, code)
+	if err != nil {
+		return User{}, AuthTokens{}, err
+	}
+
+	// the insert is what makes it single-use when two requests race with the same challenge
+	redeemedNow, err := h.sessionRepo.RedeemToken(ctx, nil, challenge)
+	if err != nil {
+		return User{}, AuthTokens{}, errors.Wrap(err, "RedeemToken error")
+	}
+	if !redeemedNow {
+		return User{}, AuthTokens{}, jwt.ErrInvalidToken
+	}
+
+	user, err := h.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return User{}, AuthTokens{}, errors.Wrap(err, "GetUserByID error")
+	}
+
+	tokens, err := h.issueTokens(ctx, user, device)
+	if err != nil {
+		return user, AuthTokens{}, errors.Wrap(err, "issueTokens error")
+	}
+
+	return user, tokens, nil
+}
+
+// issueTwoFactorChallenge returns the token the client exchanges, together with a code, for the real tokens
+func (h *userHandler) issueTwoFactorChallenge(user User) (string, error) {
+	challengeToken, err := h.jwtProvider.GenerateToken(jwt.BuildChallengeClaims(user.ID, twoFactorChallengeExpiry))
+	if err != nil {
+		return "", errors.Wrap(err, "GenerateToken error")
+	}
+
+	return challengeToken, nil
+}
+
+// getTOTP returns the enrollment of the user with its secret decrypted. sql.ErrNoRows is
+// returned as is when the user has not enrolled
+func (h *userHandler) getTOTP(ctx context.Context, userID string) (twofactor.TOTP, error) {
+	enrollment, err := h.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return enrollment, err
+		}
+
+		return enrollment, errors.Wrap(err, "GetTOTP error")
+	}
+
+	// secrets stored before they were encrypted stay usable until encrypt-totp-secrets is run
+	if encryption.IsEncrypted(enrollment.Secret) {
+		enrollment.Secret, err = h.totpCipher.Decrypt(enrollment.Secret, userID)
+		if err != nil {
+			return enrollment, errors.Wrap(err, "Decrypt error")
+		}
+	}
+
+	return enrollment, nil
+}
+
+// verifySecondFactor accepts either a TOTP code, which cannot be replayed, or an unused recovery code
+func (h *userHandler) verifySecondFactor(ctx context.Context, enrollment twofactor.TOTP, code string) error {
+	code = strings.TrimSpace(code)
+
+	if len(code) == totp.Digits {
+		step, valid := totp.Validate(enrollment.Secret, code, time.Now().UTC(), totpSkew)
+		if !valid {
+			return config.ErrInvalidTwoFactorCode
+		}
+
+		used, err := h.twoFactorRepo.UseTOTPStep(ctx, nil, enrollment.UserID, step)
+		if err != nil {
+			return errors.Wrap(err, "UseTOTPStep error")
+		}
+		if !used {
+			return config.ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	used, err := h.twoFactorRepo.UseRecoveryCode(ctx, nil, enrollment.UserID,
+		hashRecoveryCode(enrollment.UserID, normalizeRecoveryCode(code)), time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "UseRecoveryCode error")
+	}
+	if !used {
+		return config.ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns the codes to show to the user once, and the hashed rows to store
+func generateRecoveryCodes(userID string, now time.Time) ([]string, []twofactor.RecoveryCode, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	rawCodes := make([]string, 0, twofactor.RecoveryCodeCount)
+	recoveryCodes := make([]twofactor.RecoveryCode, 0, twofactor.RecoveryCodeCount)
+	for i := 0; i < twofactor.RecoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, errors.Wrap(err, "rand.Read error")
+		}
+
+		raw := encoding.EncodeToString(b)[:recoveryCodeLength]
+		rawCodes = append(rawCodes, raw[:recoveryCodeLength/2]+"-"+raw[recoveryCodeLength/2:])
+		recoveryCodes = append(recoveryCodes, twofactor.RecoveryCode{
+			ID:        uuid.NewString(),
+			UserID:    userID,
+			CodeHash:  hashRecoveryCode(userID, raw),
+			CreatedAt: now,
+		})
+	}
+
+	return rawCodes, recoveryCodes, nil
+}
+
+// normalizeRecoveryCode lets users type the code in any case, with or without the dash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func hashRecoveryCode(userID, code string) string {
+	return token.Hash(userID + ":" + code)
+}
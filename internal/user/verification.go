@@ -0,0 +1,215 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahmadnaufal/openidea-segokuning/internal/config"
+	"github.com/ahmadnaufal/openidea-segokuning/internal/verification"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/notifier"
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/token"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	verificationCodeDigits = 6
+	// verificationCodeCooldown is the minimum delay between two codes sent for the same purpose
+	verificationCodeCooldown = time.Minute
+)
+
+type verificationMessage struct {
+	subject string
+	// body is formatted with the code and its lifetime in minutes
+	body string
+}
+
+var verificationMessages = map[string]verificationMessage{
+	verification.PurposePasswordReset: {
+		subject: "Reset your Segokuning password",
+		body:    "Your Segokuning password reset code is %s. It expires in %d minutes. If you did not ask to reset your password, you can ignore this message.",
+	},
+	verification.PurposeLinkEmail: {
+		subject: "Verify your email for Segokuning",
+		body:    "Your Segokuning verification code is %s. It expires in %d minutes. Enter it in the app to link this email to your account.",
+	},
+	verification.PurposeLinkPhone: {
+		subject: "Verify your phone for Segokuning",
+		body:    "Your Segokuning verification code is %s. It expires in %d minutes.",
+	},
+	verification.PurposeChangeEmail: {
+		subject: "Confirm your new Segokuning email",
+		body:    "Your Segokuning verification code is %s. It expires in %d minutes. Enter it in the app to start using this email for your account.",
+	},
+	verification.PurposeChangePhone: {
+		subject: "Confirm your new Segokuning phone",
+		body:    "Your Segokuning verification code is %s. It expires in %d minutes.",
+	},
+}
+
+// createVerificationCode stores a fresh code for the purpose, invalidating the pending ones,
+// and returns the raw code to be delivered to target
+func (h *userHandler) createVerificationCode(ctx context.Context, userID, purpose, target string) (string, error) {
+	now := time.Now().UTC()
+
+	latest, err := h.codeRepo.GetActiveCode(ctx, userID, purpose)
+	if err != nil && err != sql.ErrNoRows {
+		return "", errors.Wrap(err, "GetActiveCode error")
+	}
+	if err == nil && now.Sub(latest.CreatedAt) < verificationCodeCooldown {
+		return "", config.ErrVerificationCodeCooldown
+	}
+
+	rawCode, err := token.GenerateNumeric(verificationCodeDigits)
+	if err != nil {
+		return "", errors.Wrap(err, "token.GenerateNumeric error")
+	}
+
+	code := verification.Code{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Purpose:   purpose,
+		Target:    target,
+		ExpiresAt: now.Add(h.verificationCodeExpiry),
+		CreatedAt: now,
+	}
+	code.CodeHash = hashVerificationCode(code.ID, rawCode)
+
+	tx, err := h.txProvider.NewTransaction(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "NewTransaction error")
+	}
+	defer tx.Rollback()
+
+	err = h.codeRepo.InvalidateCodes(ctx, tx, userID, purpose, now)
+	if err != nil {
+		return "", errors.Wrap(err, "InvalidateCodes error")
+	}
+
+	err = h.codeRepo.CreateCode(ctx, tx, code)
+	if err != nil {
+		return "", errors.Wrap(err, "CreateCode error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", errors.Wrap(err, "Commit error")
+	}
+
+	return rawCode, nil
+}
+
+// sendVerificationCode delivers the code by email or SMS, depending on the credential type of target
+func (h *userHandler) sendVerificationCode(ctx context.Context, purpose, credentialType, target, rawCode string) error {
+	template := verificationMessages[purpose]
+	msg := notifier.Message{
+		To:      target,
+		Subject: template.subject,
+		Body:    fmt.Sprintf(template.body, rawCode, int(h.verificationCodeExpiry.Minutes())),
+	}
+
+	var err error
+	if credentialType == "email" {
+		err = h.emailNotifier.Send(ctx, msg)
+	} else {
+		err = h.smsNotifier.Send(ctx, msg)
+	}
+	if err != nil {
+		return errors.Wrap(err, "notifier.Send error")
+	}
+
+	return nil
+}
+
+// sendCredentialChangedNotice tells the previous email/phone of the account that it has been replaced,
+// so the owner notices if someone else took over the account
+func (h *userHandler) sendCredentialChangedNotice(ctx context.Context, credentialType, oldValue, newValue string) error {
+	msg := notifier.Message{
+		To:      oldValue,
+		Subject: "Your Segokuning account details were changed",
+		Body: fmt.Sprintf(
+			"The %s of your Segokuning account was changed to %s. If you did not make this change, reset your password and contact our support right away.",
+			credentialType, maskCredential(credentialType, newValue),
+		),
+	}
+
+	var err error
+	if credentialType == "email" {
+		err = h.emailNotifier.Send(ctx, msg)
+	} else {
+		err = h.smsNotifier.Send(ctx, msg)
+	}
+	if err != nil {
+		return errors.Wrap(err, "notifier.Send error")
+	}
+
+	return nil
+}
+
+// maskCredential hides most of an email or phone, e.g. j***@example.com or ********789
+func maskCredential(credentialType, value string) string {
+	if credentialType == "email" {
+		at := strings.LastIndex(value, "@")
+		if at < 1 {
+			return "***"
+		}
+
+		return value[:1] + "***" + value[at:]
+	}
+
+	if len(value) <= 3 {
+		return "***"
+	}
+
+	return strings.Repeat("*", len(value)-3) + value[len(value)-3:]
+}
+
+// consumeVerificationCode checks rawCode against the user's pending code for the purpose and burns it.
+// Every guess counts towards verification.MaxAttempts, it is reserved before the code is compared
+func (h *userHandler) consumeVerificationCode(ctx context.Context, userID, purpose, rawCode string) (verification.Code, error) {
+	now := time.Now().UTC()
+
+	code, err := h.codeRepo.GetActiveCode(ctx, userID, purpose)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return code, config.ErrInvalidVerificationCode
+		}
+
+		return code, errors.Wrap(err, "GetActiveCode error")
+	}
+
+	if now.After(code.ExpiresAt) {
+		return code, config.ErrInvalidVerificationCode
+	}
+
+	reserved, err := h.codeRepo.ReserveAttempt(ctx, nil, code.ID, verification.MaxAttempts)
+	if err != nil {
+		return code, errors.Wrap(err, "ReserveAttempt error")
+	}
+	if !reserved {
+		return code, config.ErrInvalidVerificationCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashVerificationCode(code.ID, rawCode)), []byte(code.CodeHash)) != 1 {
+		return code, config.ErrInvalidVerificationCode
+	}
+
+	consumed, err := h.codeRepo.ConsumeCode(ctx, nil, code.ID, now)
+	if err != nil {
+		return code, errors.Wrap(err, "ConsumeCode error")
+	}
+	if !consumed {
+		return code, config.ErrInvalidVerificationCode
+	}
+
+	return code, nil
+}
+
+func hashVerificationCode(codeID, rawCode string) string {
+	// the code ID salts the hash so equal codes never share a digest
+	return token.Hash(codeID + ":" + rawCode)
+}
@@ -0,0 +1,30 @@
+package verification
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeLinkEmail     = "link_email"
+	PurposeLinkPhone     = "link_phone"
+	PurposeChangeEmail   = "change_email"
+	PurposeChangePhone   = "change_phone"
+)
+
+// MaxAttempts is how many guesses a code tolerates before it is burned
+const MaxAttempts = 5
+
+// Code is a short-lived one-time code sent to Target. Only the hash of the code is stored
+type Code struct {
+	ID         string       `db:"id"`
+	UserID     string       `db:"user_id"`
+	Purpose    string       `db:"purpose"`
+	Target     string       `db:"target"`
+	CodeHash   string       `db:"code_hash"`
+	Attempts   int          `db:"attempts"`
+	ExpiresAt  time.Time    `db:"expires_at"`
+	ConsumedAt sql.NullTime `db:"consumed_at"`
+	CreatedAt  time.Time    `db:"created_at"`
+}
@@ -0,0 +1,170 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type CodeRepo struct {
+	db *sqlx.DB
+}
+
+func NewCodeRepo(db *sqlx.DB) CodeRepo {
+	return CodeRepo{db: db}
+}
+
+func (r *CodeRepo) CreateCode(ctx context.Context, tx *sql.Tx, code Code) error {
+	query := `
+		INSERT INTO verification_codes
+			(id, user_id, purpose, target, code_hash, expires_at, created_at)
+		VALUES
+			(:id, :user_id, :purpose, :target, :code_hash, :expires_at, :created_at)
+	`
+
+	updatedQuery, args, err := sqlx.Named(query, code)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	} else {
+		_, err = r.db.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, updatedQuery), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetActiveCode returns the latest unconsumed code of the user for the given purpose
+func (r *CodeRepo) GetActiveCode(ctx context.Context, userID, purpose string) (Code, error) {
+	var result Code
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			purpose,
+			target,
+			code_hash,
+			attempts,
+			expires_at,
+			consumed_at,
+			created_at
+		FROM
+			verification_codes
+		WHERE
+			user_id = $1
+			AND purpose = $2
+			AND consumed_at IS NULL
+		ORDER BY
+			created_at DESC
+		LIMIT 1
+	`
+
+	err := r.db.GetContext(ctx, &result, query, userID, purpose)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ReserveAttempt counts a guess against the code before it is compared, so concurrent guesses
+// cannot all pass the limit. It returns false when the code has no attempts left
+func (r *CodeRepo) ReserveAttempt(ctx context.Context, tx *sql.Tx, id string, maxAttempts int) (bool, error) {
+	query := `
+		UPDATE
+			verification_codes
+		SET
+			attempts = attempts + 1
+		WHERE
+			id = $1
+			AND attempts < $2
+		RETURNING
+			attempts
+	`
+
+	var (
+		attempts int
+		err      error
+	)
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, id, maxAttempts).Scan(&attempts)
+	} else {
+		err = r.db.QueryRowContext(ctx, query, id, maxAttempts).Scan(&attempts)
+	}
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ConsumeCode marks the code as used. It returns false when the code was consumed concurrently
+func (r *CodeRepo) ConsumeCode(ctx context.Context, tx *sql.Tx, id string, consumedAt time.Time) (bool, error) {
+	query := `
+		UPDATE
+			verification_codes
+		SET
+			consumed_at = $2
+		WHERE
+			id = $1
+			AND consumed_at IS NULL
+	`
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if tx != nil {
+		result, err = tx.ExecContext(ctx, query, id, consumedAt)
+	} else {
+		result, err = r.db.ExecContext(ctx, query, id, consumedAt)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// InvalidateCodes consumes every pending code of the user for the given purpose,
+// so only the most recently sent code is ever usable
+func (r *CodeRepo) InvalidateCodes(ctx context.Context, tx *sql.Tx, userID, purpose string, consumedAt time.Time) error {
+	query := `
+		UPDATE
+			verification_codes
+		SET
+			consumed_at = $3
+		WHERE
+			user_id = $1
+			AND purpose = $2
+			AND consumed_at IS NULL
+	`
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, userID, purpose, consumedAt)
+	} else {
+		_, err = r.db.ExecContext(ctx, query, userID, purpose, consumedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
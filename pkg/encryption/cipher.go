@@ -0,0 +1,91 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Prefix marks the values sealed by a Cipher, so they can be told apart from values stored
+// before encryption was introduced
+const Prefix = "v1:"
+
+// KeySize is the length of the key in bytes, which selects AES-256
+const KeySize = 32
+
+var ErrMalformedCiphertext = errors.New("malformed ciphertext")
+
+// Cipher seals secrets the application has to read back, e.g. TOTP secrets, with AES-GCM
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns a Cipher using the given KeySize bytes key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "aes.NewCipher error")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher.NewGCM error")
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// NewCipherFromBase64 returns a Cipher using a base64 encoded key, as found in the config
+func NewCipherFromBase64(encodedKey string) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decode error")
+	}
+
+	return NewCipher(key)
+}
+
+// Encrypt seals plaintext. The associated data, e.g. the owner ID, is not stored but has to
+// be given again to decrypt, so a ciphertext copied to another row does not open
+func (c *Cipher) Encrypt(plaintext, associatedData string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "rand.Read error")
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), []byte(associatedData))
+	return Prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value returned by Encrypt with the same associated data
+func (c *Cipher) Decrypt(ciphertext, associatedData string) (string, error) {
+	if !IsEncrypted(ciphertext) {
+		return "", ErrMalformedCiphertext
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(ciphertext, Prefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", ErrMalformedCiphertext
+	}
+
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, []byte(associatedData))
+	if err != nil {
+		return "", errors.Wrap(err, "aead.Open error")
+	}
+
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether value was returned by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
@@ -0,0 +1,95 @@
+// Package handle holds the rules of user @handles and finds the mentions in a text
+package handle
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+	// maxMentions caps how many handles are resolved from a single text
+	maxMentions = 20
+)
+
+var (
+	ErrInvalidLength = errors.New("handle must be between 3 and 30 characters long")
+	ErrInvalidFormat = errors.New("handle may only contain letters, digits and underscores, and must start with a letter")
+	ErrReserved      = errors.New("handle is reserved")
+)
+
+var (
+	handlePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+	// a mention is an @ not preceded by a word character, so emails do not count as mentions
+	mentionPattern = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@.])@([a-zA-Z][a-zA-Z0-9_]{2,29})\b`)
+)
+
+// reserved handles would be confusing next to our own routes and official accounts
+var reserved = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"app":           true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"moderator":     true,
+	"null":          true,
+	"official":      true,
+	"register":      true,
+	"root":          true,
+	"security":      true,
+	"segokuning":    true,
+	"settings":      true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+	"user":          true,
+}
+
+// Normalize returns the form handles are compared in: without the leading @ and lowercased
+func Normalize(h string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(h), "@"))
+}
+
+// Validate checks h, without its leading @, against the handle rules
+func Validate(h string) error {
+	if len(h) < MinLength || len(h) > MaxLength {
+		return ErrInvalidLength
+	}
+
+	if !handlePattern.MatchString(h) {
+		return ErrInvalidFormat
+	}
+
+	if reserved[strings.ToLower(h)] {
+		return ErrReserved
+	}
+
+	return nil
+}
+
+// ExtractMentions returns the normalized, deduplicated handles mentioned in text, in order of appearance
+func ExtractMentions(text string) []string {
+	mentions := []string{}
+	seen := map[string]bool{}
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		h := strings.ToLower(match[1])
+		if seen[h] || reserved[h] {
+			continue
+		}
+
+		seen[h] = true
+		mentions = append(mentions, h)
+		if len(mentions) == maxMentions {
+			break
+		}
+	}
+
+	return mentions
+}
@@ -1,7 +1,12 @@
 package jwt
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
@@ -9,53 +14,311 @@ import (
 	"github.com/pkg/errors"
 )
 
-var defaultSigningMethod *jwt.SigningMethodHMAC = jwt.SigningMethodHS256
+// legacyKeyID identifies the JWT_SECRET key. Tokens signed before key IDs were introduced
+// carry no kid header and are verified with it
+const legacyKeyID = "default"
+
+// PersonalTokenPrefix starts every personal access token, which tells them apart from JWTs
+// and makes leaked tokens easy to spot by secret scanners
+const PersonalTokenPrefix = "sgk_pat_"
+
+func init() {
+	// iat and exp carry milliseconds instead of whole seconds, so a token issued right after a
+	// "log out everywhere" can be told apart from the ones it revoked
+	jwt.TimePrecision = time.Millisecond
+}
+
+var (
+	ErrTokenRevoked  = fiber.NewError(http.StatusUnauthorized, "token has been revoked")
+	ErrInvalidClaims = fiber.NewError(http.StatusUnauthorized, "token issuer or audience is invalid")
+	ErrInvalidToken  = fiber.NewError(http.StatusUnauthorized, "token is invalid or expired")
+
+	ErrPersonalTokenNotAllowed = fiber.NewError(http.StatusForbidden, "personal access tokens cannot be used for this endpoint")
+	ErrInsufficientScope       = fiber.NewError(http.StatusForbidden, "token is missing the scope required by this endpoint")
+)
+
+// RevocationChecker reports whether an otherwise valid token has been revoked before its expiry
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, user JWTUser) (bool, error)
+}
+
+// PersonalTokenAuthenticator looks up the user of a personal access token. It returns
+// ErrInvalidToken for unknown, expired and revoked tokens
+type PersonalTokenAuthenticator interface {
+	AuthenticatePersonalToken(ctx context.Context, rawToken string) (JWTUser, error)
+}
+
+type ProviderConfig struct {
+	// Secret is the base64 encoded HS256 secret. Optional once asymmetric keys are configured,
+	// keep it set while tokens signed with it are still in circulation
+	Secret string
+	// KeysDir holds the <kid>.pem RSA/Ed25519 keys
+	KeysDir string
+	// ActiveKeyID is the key new tokens are signed with. Defaults to the secret key
+	ActiveKeyID string
+	Issuer      string
+	Audience    string
+}
 
 type JWTProvider struct {
-	privateKey []byte
+	keys              []SigningKey
+	keysByID          map[string]SigningKey
+	activeKey         SigningKey
+	issuer            string
+	audience          string
+	revocationChecker RevocationChecker
+
+	personalTokenAuthenticator PersonalTokenAuthenticator
 }
 
-func NewJWTProvider(privateKey string) JWTProvider {
-	privateKeyDecoded, _ := base64.StdEncoding.DecodeString(privateKey)
+func NewJWTProvider(cfg ProviderConfig) (JWTProvider, error) {
+	provider := JWTProvider{
+		keysByID: map[string]SigningKey{},
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
 
-	return JWTProvider{
-		privateKey: privateKeyDecoded,
+	if cfg.Secret != "" {
+		secret, err := base64.StdEncoding.DecodeString(cfg.Secret)
+		if err != nil {
+			return provider, errors.Wrap(err, "JWT secret is not valid base64")
+		}
+
+		provider.addKey(NewHMACKey(legacyKeyID, secret))
+	}
+
+	if cfg.KeysDir != "" {
+		keys, err := LoadKeysFromDir(cfg.KeysDir)
+		if err != nil {
+			return provider, errors.Wrap(err, "LoadKeysFromDir error")
+		}
+
+		for _, key := range keys {
+			provider.addKey(key)
+		}
 	}
+
+	activeKeyID := cfg.ActiveKeyID
+	if activeKeyID == "" {
+		activeKeyID = legacyKeyID
+	}
+
+	activeKey, found := provider.keysByID[activeKeyID]
+	if !found {
+		return provider, fmt.Errorf("active JWT key %q is not configured", activeKeyID)
+	}
+	if !activeKey.CanSign() {
+		return provider, fmt.Errorf("active JWT key %q has no private key", activeKeyID)
+	}
+	provider.activeKey = activeKey
+
+	return provider, nil
+}
+
+func (p *JWTProvider) addKey(key SigningKey) {
+	p.keys = append(p.keys, key)
+	p.keysByID[key.ID] = key
+}
+
+// SetRevocationChecker makes every middleware created afterwards reject revoked tokens
+func (p *JWTProvider) SetRevocationChecker(checker RevocationChecker) {
+	p.revocationChecker = checker
+}
+
+func (p *JWTProvider) SetPersonalTokenAuthenticator(authenticator PersonalTokenAuthenticator) {
+	p.personalTokenAuthenticator = authenticator
 }
 
 func (p *JWTProvider) GenerateToken(payload jwt.MapClaims) (string, error) {
-	token, err := jwt.NewWithClaims(defaultSigningMethod, payload).SignedString(p.privateKey)
+	if p.issuer != "" {
+		payload["iss"] = p.issuer
+	}
+	if p.audience != "" {
+		payload["aud"] = p.audience
+	}
+
+	token := jwt.NewWithClaims(p.activeKey.Method, payload)
+	token.Header["kid"] = p.activeKey.ID
+
+	signed, err := token.SignedString(p.activeKey.privateKey)
 	if err != nil {
 		return "", errors.Wrap(err, "error returning signed string")
 	}
 
-	return token, nil
+	return signed, nil
+}
+
+// keyFunc picks the verification key from the kid header, and refuses any algorithm
+// other than the one the key was configured with
+func (p *JWTProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+
+	key, found := p.keysByID[kid]
+	if !found {
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected jwt signing method: expected: %q: got: %q", key.Method.Alg(), token.Method.Alg())
+	}
+
+	return key.publicKey, nil
 }
 
 func (p *JWTProvider) MiddlewareWithPublic() fiber.Handler {
 	return jwtware.New(jwtware.Config{
 		ContextKey: "user",
 		Claims:     jwt.MapClaims{},
-		SigningKey: jwtware.SigningKey{
-			JWTAlg: jwtware.HS256,
-			Key:    p.privateKey,
-		},
+		KeyFunc:    p.keyFunc,
 		Filter: func(c *fiber.Ctx) bool {
 			// only filter if there's userOnly
 			return !c.QueryBool("userOnly", false)
 		},
+		SuccessHandler: p.validateToken,
 	})
 }
 
-func (p *JWTProvider) Middleware() fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		ContextKey: "user",
-		Claims:     jwt.MapClaims{},
-		SigningKey: jwtware.SigningKey{
-			JWTAlg: jwtware.HS256,
-			Key:    p.privateKey,
-		},
+// Middleware authenticates the request with an access token. Personal access tokens are only
+// accepted when scopes are given, and must hold every one of them
+func (p *JWTProvider) Middleware(scopes ...string) fiber.Handler {
+	jwtMiddleware := jwtware.New(jwtware.Config{
+		ContextKey:     "user",
+		Claims:         jwt.MapClaims{},
+		KeyFunc:        p.keyFunc,
+		SuccessHandler: p.validateToken,
 	})
+
+	return func(c *fiber.Ctx) error {
+		rawToken := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !strings.HasPrefix(rawToken, PersonalTokenPrefix) {
+			return jwtMiddleware(c)
+		}
+
+		return p.authenticatePersonalToken(c, rawToken, scopes)
+	}
+}
+
+func (p *JWTProvider) authenticatePersonalToken(c *fiber.Ctx, rawToken string, scopes []string) error {
+	// endpoints without scopes manage the account itself, they need a logged in user
+	if len(scopes) == 0 {
+		return ErrPersonalTokenNotAllowed
+	}
+
+	if p.personalTokenAuthenticator == nil {
+		return ErrInvalidToken
+	}
+
+	user, err := p.personalTokenAuthenticator.AuthenticatePersonalToken(c.Context(), rawToken)
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if !user.HasScope(scope) {
+			return ErrInsufficientScope
+		}
+	}
+
+	c.Locals("user", &jwt.Token{
+		Valid:  true,
+		Claims: BuildPersonalTokenClaims(user),
+	})
+
+	return c.Next()
+}
+
+// validateToken runs the checks the signature verification does not cover
+func (p *JWTProvider) validateToken(c *fiber.Ctx) error {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+
+	if err := p.validateIssuerAndAudience(token.Claims); err != nil {
+		return err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if typ, found := claims["typ"]; found && typ != TokenTypeAccess {
+			return fiber.ErrUnauthorized
+		}
+	}
+
+	return p.checkRevocation(c)
+}
+
+// ParseToken verifies a token outside of the middleware, e.g. one sent in a request body,
+// and checks that it is of the expected type
+func (p *JWTProvider) ParseToken(rawToken, tokenType string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(rawToken, claims, p.keyFunc)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err := p.validateIssuerAndAudience(claims); err != nil {
+		return nil, err
+	}
+
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (p *JWTProvider) validateIssuerAndAudience(claims jwt.Claims) error {
+	if p.issuer != "" {
+		issuer, err := claims.GetIssuer()
+		if err != nil || issuer != p.issuer {
+			return ErrInvalidClaims
+		}
+	}
+
+	if p.audience != "" {
+		audience, err := claims.GetAudience()
+		if err != nil {
+			return ErrInvalidClaims
+		}
+
+		found := false
+		for _, aud := range audience {
+			if aud == p.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrInvalidClaims
+		}
+	}
+
+	return nil
+}
+
+func (p *JWTProvider) checkRevocation(c *fiber.Ctx) error {
+	if p.revocationChecker == nil {
+		return c.Next()
+	}
+
+	user, err := GetLoggedInUser(c)
+	if err != nil {
+		return fiber.ErrUnauthorized
+	}
+
+	revoked, err := p.revocationChecker.IsRevoked(c.Context(), user)
+	if err != nil {
+		return errors.Wrap(err, "IsRevoked error")
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+
+	return c.Next()
 }
 
 func GetLoggedInUser(c *fiber.Ctx) (JWTUser, error) {
@@ -76,5 +339,39 @@ func GetLoggedInUser(c *fiber.Ctx) (JWTUser, error) {
 	jwtUser.Email = claims["email"].(string)
 	jwtUser.Phone = claims["phone"].(string)
 
+	// registered claims below are missing from tokens issued before revocation support
+	jwtUser.TokenID, _ = claims["jti"].(string)
+	jwtUser.TokenType, _ = claims["typ"].(string)
+	if jwtUser.TokenType == "" {
+		jwtUser.TokenType = TokenTypeAccess
+	}
+	jwtUser.SessionID, _ = claims["sid"].(string)
+	// tokens issued before roles existed carry no role and no permissions
+	jwtUser.Role, _ = claims["role"].(string)
+	if permissions, ok := claims["permissions"].([]interface{}); ok {
+		for _, p := range permissions {
+			if permission, ok := p.(string); ok {
+				jwtUser.Permissions = append(jwtUser.Permissions, permission)
+			}
+		}
+	}
+	// personal access tokens are read back from the claims built by the middleware
+	switch scopes := claims["scopes"].(type) {
+	case []string:
+		jwtUser.Scopes = scopes
+	case []interface{}:
+		for _, s := range scopes {
+			if scope, ok := s.(string); ok {
+				jwtUser.Scopes = append(jwtUser.Scopes, scope)
+			}
+		}
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		jwtUser.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		jwtUser.ExpiresAt = exp.Time
+	}
+
 	return jwtUser, nil
 }
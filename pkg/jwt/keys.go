@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// SigningKey is one entry of the provider key set. Keys without a private part
+// can only verify tokens, which is how retired keys are kept around during rotation
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	// privateKey is []byte, *rsa.PrivateKey or ed25519.PrivateKey. nil for verify-only keys
+	privateKey interface{}
+	// publicKey is []byte, *rsa.PublicKey or ed25519.PublicKey
+	publicKey interface{}
+}
+
+func (k SigningKey) CanSign() bool {
+	return k.privateKey != nil
+}
+
+func NewHMACKey(id string, secret []byte) SigningKey {
+	return SigningKey{
+		ID:         id,
+		Method:     jwt.SigningMethodHS256,
+		privateKey: secret,
+		publicKey:  secret,
+	}
+}
+
+// ParsePEMKey reads an RSA or Ed25519 key. A private key (PKCS#1 or PKCS#8) can sign and verify,
+// a public key (PKIX) can only verify. RSA keys sign with RS256, Ed25519 keys with EdDSA
+func ParsePEMKey(id string, pemBytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %s: no PEM block found", id)
+	}
+
+	var (
+		parsed interface{}
+		err    error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unsupported PEM block type %q", id, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, errors.Wrapf(err, "key %s: parse error", id)
+	}
+
+	key := SigningKey{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.privateKey = k
+		key.publicKey = &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+		key.publicKey = k
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.privateKey = k
+		key.publicKey = k.Public()
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.publicKey = k
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+
+	return key, nil
+}
+
+// LoadKeysFromDir loads every <kid>.pem file of dir, the file name without extension being the key ID
+func LoadKeysFromDir(dir string) ([]SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, errors.Wrap(err, "filepath.Glob error")
+	}
+	sort.Strings(paths)
+
+	keys := []SigningKey{}
+	for _, path := range paths {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "os.ReadFile error")
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := ParsePEMKey(id, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
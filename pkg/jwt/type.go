@@ -4,6 +4,15 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// token types carried in the "typ" claim. Tokens issued before the claim existed are access tokens
+const (
+	TokenTypeAccess             = "access"
+	TokenTypeTwoFactorChallenge = "2fa_challenge"
+	// TokenTypePersonal marks a user authenticated with a personal access token instead of a JWT
+	TokenTypePersonal = "personal"
 )
 
 type JWTUser struct {
@@ -11,14 +20,104 @@ type JWTUser struct {
 	Name   string `json:"name"`
 	Email  string `json:"email"`
 	Phone  string `json:"phone"`
+	// SessionID is the login session the token was issued for
+	SessionID string `json:"sid"`
+	// Role and Permissions are those of the user when the token was issued
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	// Scopes restrict what a personal access token can call. Unused for other tokens
+	Scopes []string `json:"scopes"`
+
+	// filled from the registered claims when reading a token
+	TokenType string    `json:"-"`
+	TokenID   string    `json:"-"`
+	IssuedAt  time.Time `json:"-"`
+	ExpiresAt time.Time `json:"-"`
 }
 
 func BuildJWTClaims(user JWTUser, expireDuration time.Duration) jwt.MapClaims {
-	return jwt.MapClaims{
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"jti":    uuid.NewString(),
+		"typ":    TokenTypeAccess,
 		"userId": user.UserID,
 		"name":   user.Name,
 		"email":  user.Email,
 		"phone":  user.Phone,
-		"exp":    jwt.NewNumericDate(time.Now().Add(expireDuration)),
+		"iat":    jwt.NewNumericDate(now),
+		"exp":    jwt.NewNumericDate(now.Add(expireDuration)),
+	}
+	if user.SessionID != "" {
+		claims["sid"] = user.SessionID
+	}
+	if user.Role != "" {
+		claims["role"] = user.Role
+	}
+	if len(user.Permissions) > 0 {
+		claims["permissions"] = user.Permissions
+	}
+
+	return claims
+}
+
+func (u JWTUser) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasScope reports whether the token may call an endpoint requiring scope. Only personal
+// access tokens are restricted, logged in users can call everything their permissions allow
+func (u JWTUser) HasScope(scope string) bool {
+	if u.TokenType != TokenTypePersonal {
+		return true
+	}
+
+	for _, s := range u.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BuildPersonalTokenClaims builds the claims the middleware stores for a request authenticated
+// with a personal access token, so handlers read the user the same way as with a JWT
+func BuildPersonalTokenClaims(user JWTUser) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"jti":    user.TokenID,
+		"typ":    TokenTypePersonal,
+		"userId": user.UserID,
+		"name":   user.Name,
+		"email":  user.Email,
+		"phone":  user.Phone,
+		"scopes": user.Scopes,
+		// dates are numbers, as in the claims of a parsed JWT
+		"iat": float64(user.IssuedAt.Unix()),
+	}
+	if !user.ExpiresAt.IsZero() {
+		claims["exp"] = float64(user.ExpiresAt.Unix())
+	}
+
+	return claims
+}
+
+// BuildChallengeClaims builds the claims of the token proving the password step of a
+// two-factor login succeeded. It cannot be used as an access token
+func BuildChallengeClaims(userID string, expireDuration time.Duration) jwt.MapClaims {
+	now := time.Now()
+
+	return jwt.MapClaims{
+		"jti":    uuid.NewString(),
+		"typ":    TokenTypeTwoFactorChallenge,
+		"userId": userID,
+		"iat":    jwt.NewNumericDate(now),
+		"exp":    jwt.NewNumericDate(now.Add(expireDuration)),
 	}
 }
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ahmadnaufal/openidea-segokuning/pkg/jwt"
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrPermissionDenied = fiber.NewError(http.StatusForbidden, "you are not allowed to perform this action")
+
+// RequirePermission only lets requests through when the access token grants every one of
+// the permissions. It must run after the JWT middleware
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := jwt.GetLoggedInUser(c)
+		if err != nil {
+			return fiber.ErrUnauthorized
+		}
+
+		for _, permission := range permissions {
+			if !user.HasPermission(permission) {
+				return ErrPermissionDenied
+			}
+		}
+
+		return c.Next()
+	}
+}
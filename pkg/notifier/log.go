@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LogNotifier is a stand-in for local development and tests. Instead of delivering the message
+// it writes it as a JSON line to the given writer, so codes can be read back from the log or file
+type LogNotifier struct {
+	mu      sync.Mutex
+	channel string
+	out     io.Writer
+}
+
+func NewLogNotifier(channel string) *LogNotifier {
+	return &LogNotifier{
+		channel: channel,
+		out:     log.Writer(),
+	}
+}
+
+// NewFileNotifier appends every message to the file at path
+func NewFileNotifier(channel, path string) (*LogNotifier, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.OpenFile error")
+	}
+
+	return &LogNotifier{
+		channel: channel,
+		out:     file,
+	}, nil
+}
+
+type loggedMessage struct {
+	Channel string    `json:"channel"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject,omitempty"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+func (n *LogNotifier) Send(_ context.Context, msg Message) error {
+	line, err := json.Marshal(loggedMessage{
+		Channel: n.channel,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Body:    msg.Body,
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal error")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, err = n.out.Write(append(line, '\n'))
+	if err != nil {
+		return errors.Wrap(err, "write notification error")
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package notifier
+
+import "context"
+
+type Message struct {
+	// To is an email address or an E.164 phone number, depending on the notifier
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers a message to a single recipient over one channel (email, SMS, ...)
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
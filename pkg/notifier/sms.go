@@ -0,0 +1,68 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SMSNotifier sends text messages through an HTTP SMS gateway which accepts
+// a JSON body of {"from", "to", "message"} authenticated with a bearer token
+type SMSNotifier struct {
+	client     *http.Client
+	gatewayURL string
+	token      string
+	sender     string
+}
+
+func NewSMSNotifier(gatewayURL, token, sender string) *SMSNotifier {
+	return &SMSNotifier{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		gatewayURL: gatewayURL,
+		token:      token,
+		sender:     sender,
+	}
+}
+
+type smsRequest struct {
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+func (n *SMSNotifier) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(smsRequest{
+		From:    n.sender,
+		To:      msg.To,
+		Message: msg.Body,
+	})
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal error")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.gatewayURL, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequest error")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "sms gateway request error")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPNotifier(host, port, username, password, from string) *SMTPNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPNotifier{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (n *SMTPNotifier) Send(_ context.Context, msg Message) error {
+	headers := []string{
+		fmt.Sprintf("From: %s", n.from),
+		fmt.Sprintf("To: %s", msg.To),
+		fmt.Sprintf("Subject: %s", msg.Subject),
+		"MIME-Version: 1.0",
+		`Content-Type: text/plain; charset="utf-8"`,
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + msg.Body
+
+	err := smtp.SendMail(n.addr, n.auth, n.from, []string{msg.To}, []byte(body))
+	if err != nil {
+		return errors.Wrap(err, "smtp.SendMail error")
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNonceMismatch  = errors.New("id token nonce does not match")
+	ErrTokenExchange  = errors.New("authorization code exchange failed")
+)
+
+// Config describes an OpenID Connect provider registered for this application
+type Config struct {
+	// Name identifies the provider in routes and in linked identities, e.g. "google"
+	Name string
+	// IssuerURL is where the discovery document is served from, without /.well-known/openid-configuration
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must be registered at the provider, it receives the authorization code
+	RedirectURL string
+	// Scopes are requested on top of "openid"
+	Scopes []string
+}
+
+// Claims are the ID token claims used to find or create the local account
+type Claims struct {
+	jwt.RegisteredClaims
+
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+	AuthorizedBy  string       `json:"azp"`
+}
+
+// HasVerifiedEmail reports whether the provider vouches for the email claim
+func (c Claims) HasVerifiedEmail() bool {
+	return c.Email != "" && bool(c.EmailVerified)
+}
+
+// flexibleBool accepts both true and "true", some providers send email_verified as a string
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	*b = flexibleBool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider runs the authorization code flow with PKCE against one OpenID Connect provider.
+// The discovery document and signing keys are fetched on first use, so the application
+// starts even when the provider is unreachable
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	jwks      *keyfunc.JWKS
+}
+
+func NewProvider(cfg Config) *Provider {
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL the user is sent to for signing in at the provider
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	doc, _, err := p.load(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	params := authURL.Query()
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+	authURL.RawQuery = params.Encode()
+
+	return authURL.String(), nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the authorization code for tokens and returns the verified ID token claims
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	doc, jwks, err := p.load(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// RFC 6749 section 2.3.1 wants both parts form-encoded before basic authentication
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("token request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return Claims{}, fmt.Errorf("token response decode error: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return Claims{}, fmt.Errorf("%w: status %d, %s %s", ErrTokenExchange, resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+
+	return p.verifyIDToken(doc, jwks, token.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(doc *discoveryDocument, jwks *keyfunc.JWKS, rawIDToken, nonce string) (Claims, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(
+		rawIDToken,
+		&claims,
+		jwks.Keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return claims, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return claims, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	// a token also meant for other clients must name us as the party it was issued to
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.cfg.ClientID {
+		return claims, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+
+	if claims.Nonce != nonce {
+		return claims, ErrNonceMismatch
+	}
+
+	return claims, nil
+}
+
+// load returns the discovery document and signing keys, fetching them on the first call
+func (p *Provider) load(ctx context.Context) (*discoveryDocument, *keyfunc.JWKS, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, p.jwks, nil
+	}
+
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jwks, err := keyfunc.Get(doc.JWKSURI, keyfunc.Options{
+		Client: p.client,
+		// keys are rotated by the provider, pick new ones up when a token names an unknown key
+		RefreshUnknownKID: true,
+		RefreshRateLimit:  5 * time.Minute,
+		RefreshInterval:   time.Hour,
+		RefreshErrorHandler: func(err error) {
+			log.Printf("failed to refresh keys of oidc provider %s: %s", p.cfg.Name, err)
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("jwks fetch error: %w", err)
+	}
+
+	p.discovery = doc
+	p.jwks = jwks
+
+	return doc, jwks, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("discovery request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery responded with status %d", resp.StatusCode)
+	}
+
+	var doc discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("discovery decode error: %w", err)
+	}
+
+	// OpenID Connect Discovery section 4.3: the issuer must be the one we asked
+	if strings.TrimSuffix(doc.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", doc.Issuer, p.cfg.IssuerURL)
+	}
+
+	return &doc, nil
+}
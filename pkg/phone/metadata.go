@@ -0,0 +1,80 @@
+package phone
+
+// country holds the national number rules of a calling code
+type country struct {
+	region string
+	// minLength and maxLength bound the digits of the national number, trunk prefix excluded
+	minLength int
+	maxLength int
+	// trunkPrefix is set when the country dials a leading 0 domestically which is dropped
+	// internationally. Italy keeps its 0, so it is not set there
+	trunkPrefix bool
+}
+
+// countries maps calling codes to the rules of the country using them. For calling codes
+// shared by several countries the rules are those of the largest one
+var countries = map[string]country{
+	"1":   {region: "US", minLength: 10, maxLength: 10},
+	"7":   {region: "RU", minLength: 10, maxLength: 10},
+	"20":  {region: "EG", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"27":  {region: "ZA", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"30":  {region: "GR", minLength: 10, maxLength: 10},
+	"31":  {region: "NL", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"32":  {region: "BE", minLength: 8, maxLength: 9, trunkPrefix: true},
+	"33":  {region: "FR", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"34":  {region: "ES", minLength: 9, maxLength: 9},
+	"36":  {region: "HU", minLength: 8, maxLength: 9},
+	"39":  {region: "IT", minLength: 6, maxLength: 11},
+	"40":  {region: "RO", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"41":  {region: "CH", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"43":  {region: "AT", minLength: 4, maxLength: 13, trunkPrefix: true},
+	"44":  {region: "GB", minLength: 7, maxLength: 10, trunkPrefix: true},
+	"45":  {region: "DK", minLength: 8, maxLength: 8},
+	"46":  {region: "SE", minLength: 7, maxLength: 10, trunkPrefix: true},
+	"47":  {region: "NO", minLength: 8, maxLength: 8},
+	"48":  {region: "PL", minLength: 9, maxLength: 9},
+	"49":  {region: "DE", minLength: 6, maxLength: 13, trunkPrefix: true},
+	"51":  {region: "PE", minLength: 8, maxLength: 9, trunkPrefix: true},
+	"52":  {region: "MX", minLength: 10, maxLength: 10},
+	"54":  {region: "AR", minLength: 10, maxLength: 11, trunkPrefix: true},
+	"55":  {region: "BR", minLength: 10, maxLength: 11, trunkPrefix: true},
+	"56":  {region: "CL", minLength: 9, maxLength: 9},
+	"57":  {region: "CO", minLength: 8, maxLength: 10},
+	"58":  {region: "VE", minLength: 10, maxLength: 10, trunkPrefix: true},
+	"60":  {region: "MY", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"61":  {region: "AU", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"62":  {region: "ID", minLength: 8, maxLength: 12, trunkPrefix: true},
+	"63":  {region: "PH", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"64":  {region: "NZ", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"65":  {region: "SG", minLength: 8, maxLength: 8},
+	"66":  {region: "TH", minLength: 8, maxLength: 9, trunkPrefix: true},
+	"81":  {region: "JP", minLength: 9, maxLength: 10, trunkPrefix: true},
+	"82":  {region: "KR", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"84":  {region: "VN", minLength: 9, maxLength: 10, trunkPrefix: true},
+	"86":  {region: "CN", minLength: 10, maxLength: 11, trunkPrefix: true},
+	"90":  {region: "TR", minLength: 10, maxLength: 10, trunkPrefix: true},
+	"91":  {region: "IN", minLength: 10, maxLength: 10, trunkPrefix: true},
+	"92":  {region: "PK", minLength: 9, maxLength: 10, trunkPrefix: true},
+	"93":  {region: "AF", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"94":  {region: "LK", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"95":  {region: "MM", minLength: 7, maxLength: 10, trunkPrefix: true},
+	"98":  {region: "IR", minLength: 10, maxLength: 10, trunkPrefix: true},
+	"212": {region: "MA", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"234": {region: "NG", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"254": {region: "KE", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"351": {region: "PT", minLength: 9, maxLength: 9},
+	"353": {region: "IE", minLength: 7, maxLength: 9, trunkPrefix: true},
+	"358": {region: "FI", minLength: 5, maxLength: 12, trunkPrefix: true},
+	"380": {region: "UA", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"670": {region: "TL", minLength: 7, maxLength: 8},
+	"673": {region: "BN", minLength: 7, maxLength: 7},
+	"852": {region: "HK", minLength: 8, maxLength: 8},
+	"853": {region: "MO", minLength: 8, maxLength: 8},
+	"855": {region: "KH", minLength: 8, maxLength: 9, trunkPrefix: true},
+	"856": {region: "LA", minLength: 8, maxLength: 10, trunkPrefix: true},
+	"880": {region: "BD", minLength: 10, maxLength: 10, trunkPrefix: true},
+	"886": {region: "TW", minLength: 8, maxLength: 9, trunkPrefix: true},
+	"966": {region: "SA", minLength: 9, maxLength: 9, trunkPrefix: true},
+	"971": {region: "AE", minLength: 8, maxLength: 9, trunkPrefix: true},
+	"972": {region: "IL", minLength: 8, maxLength: 9, trunkPrefix: true},
+}
@@ -0,0 +1,116 @@
+// Package phone parses international phone numbers and normalizes them to E.164,
+// the form phone numbers are stored and looked up in
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// E.164 numbers carry at most 15 digits, country calling code included
+	maxDigits = 15
+	// shortest number the generic rules accept for calling codes without metadata
+	minDigits = 8
+)
+
+var (
+	ErrMissingCountryCode = errors.New("phone number must start with + and the country calling code")
+	ErrInvalidFormat      = errors.New("phone number may only contain digits, spaces, dashes, dots and parentheses")
+	ErrInvalidLength      = errors.New("phone number has the wrong number of digits for its country")
+)
+
+// Number is a parsed phone number
+type Number struct {
+	// CountryCode is the calling code without the +, e.g. "62".
+	// Empty when the calling code has no metadata, NationalNumber then holds all digits
+	CountryCode string
+	// NationalNumber is the number without the calling code and without the trunk prefix
+	NationalNumber string
+	// Region is the ISO 3166 code of the country, empty when the calling code has no metadata
+	Region string
+}
+
+// E164 returns the number as stored, e.g. "+6281234567890"
+func (n Number) E164() string {
+	return "+" + n.CountryCode + n.NationalNumber
+}
+
+// Parse reads a number written in international format, either with a leading + or 00.
+// Spaces, dashes, dots and parentheses are ignored, as is the trunk prefix of countries
+// which dial one domestically, so "+62 (0)812-3456-7890" and "+6281234567890" are the same number.
+// Numbers of calling codes we have metadata for must have the national length of that country,
+// other numbers are only held to the E.164 limits
+func Parse(raw string) (Number, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+
+	if strings.HasPrefix(digits, "00") {
+		digits = digits[2:]
+	} else if strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	} else {
+		return Number{}, ErrMissingCountryCode
+	}
+
+	if digits == "" {
+		return Number{}, ErrMissingCountryCode
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return Number{}, ErrInvalidFormat
+		}
+	}
+	if digits[0] == '0' {
+		return Number{}, ErrMissingCountryCode
+	}
+
+	code, meta, ok := lookupCountry(digits)
+	if !ok {
+		if len(digits) < minDigits || len(digits) > maxDigits {
+			return Number{}, ErrInvalidLength
+		}
+
+		// without metadata the split between calling code and national number is unknown,
+		// which does not matter for the E.164 form
+		return Number{NationalNumber: digits}, nil
+	}
+
+	national := digits[len(code):]
+	if meta.trunkPrefix && strings.HasPrefix(national, "0") {
+		national = national[1:]
+	}
+
+	if len(national) < meta.minLength || len(national) > meta.maxLength || len(code)+len(national) > maxDigits {
+		return Number{}, ErrInvalidLength
+	}
+
+	return Number{CountryCode: code, NationalNumber: national, Region: meta.region}, nil
+}
+
+// Normalize parses raw and returns its E.164 form
+func Normalize(raw string) (string, error) {
+	number, err := Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	return number.E164(), nil
+}
+
+// lookupCountry finds the calling code digits start with. Calling codes are prefix-free,
+// so at most one of the 1 to 3 digit prefixes is a calling code
+func lookupCountry(digits string) (string, country, bool) {
+	for length := 1; length <= 3 && length < len(digits); length++ {
+		if meta, ok := countries[digits[:length]]; ok {
+			return digits[:length], meta, true
+		}
+	}
+
+	return "", country{}, false
+}
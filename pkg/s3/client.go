@@ -3,7 +3,10 @@ package s3
 import (
 	"context"
 	"fmt"
+	"io"
 	"mime/multipart"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
@@ -55,3 +58,62 @@ func (s *S3Provider) UploadImage(ctx context.Context, fileHeader *multipart.File
 	finalUrl := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, filename)
 	return finalUrl, nil
 }
+
+// KeyFromURL returns the object key of a URL returned by UploadImage. It returns false
+// for URLs pointing anywhere else than our bucket
+func (s *S3Provider) KeyFromURL(url string) (string, bool) {
+	prefix := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", s.bucket, s.region)
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+
+	key := strings.TrimPrefix(url, prefix)
+	if key == "" {
+		return "", false
+	}
+
+	return key, true
+}
+
+func (s *S3Provider) DeleteObject(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.Wrap(err, "s3Client.DeleteObject error")
+	}
+
+	return nil
+}
+
+// PutPrivateObject stores an object only reachable through presigned URLs
+func (s *S3Provider) PutPrivateObject(ctx context.Context, key, contentType string, body io.Reader) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ACL:         types.ObjectCannedACLPrivate,
+		ContentType: aws.String(contentType),
+		Body:        body,
+	})
+	if err != nil {
+		return errors.Wrap(err, "s3Client.PutObject error")
+	}
+
+	return nil
+}
+
+// PresignGetObject returns a URL granting read access to a private object for ttl
+func (s *S3Provider) PresignGetObject(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", errors.Wrap(err, "PresignGetObject error")
+	}
+
+	return request.URL, nil
+}
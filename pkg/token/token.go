@@ -0,0 +1,42 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Generate returns a URL-safe random string built from byteLength bytes of crypto/rand output
+func Generate(byteLength int) (string, error) {
+	buf := make([]byte, byteLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "rand.Read error")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash returns the hex-encoded SHA-256 digest of value. Random tokens are stored hashed
+// so a leaked table cannot be replayed as credentials
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateNumeric returns a random code made of the given number of decimal digits
+func GenerateNumeric(digits int) (string, error) {
+	code := make([]byte, digits)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", errors.Wrap(err, "rand.Int error")
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+
+	return string(code), nil
+}
@@ -3,27 +3,158 @@ package validation
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
-var validate = validator.New(validator.WithRequiredStructEnabled())
+var validate = newValidator()
 
-func Validate(data any) error {
-	err := validate.Struct(data)
-	if err != nil {
-		strError := ""
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
 
-		if validationErrors, ok := err.(validator.ValidationErrors); ok {
-			for _, vErr := range validationErrors {
-				strError += fmt.Sprintf("%s;", vErr.Error())
+	// report fields by the name clients send them with
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "query", "params", "form"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
 			}
-		} else {
-			strError = err.Error()
 		}
 
-		return errors.New(strError)
+		return field.Name
+	})
+
+	return v
+}
+
+// FieldError describes why a single field of a request was rejected
+type FieldError struct {
+	// Field is the name of the field as sent by the client, e.g. "credentialValue" or "tags[1]"
+	Field string `json:"field"`
+	// Rule is the name of the rule the field broke, e.g. "required" or "max"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors collects every field error of a request, so clients can point at all the bad fields at once
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	strErrors := []string{}
+	for _, v := range e {
+		strErrors = append(strErrors, fmt.Sprintf("%s %s", v.Field, v.Message))
+	}
+
+	return strings.Join(strErrors, "; ")
+}
+
+// Add appends an error for field, for the checks struct tags cannot express
+func (e *Errors) Add(field, rule, message string) {
+	*e = append(*e, FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// Err returns nil when nothing was added, so the result can be returned as an error directly
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Validate checks data against its validate struct tags. Rule violations are returned as Errors
+func Validate(data any) error {
+	err := validate.Struct(data)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	errs := Errors{}
+	for _, vErr := range validationErrors {
+		rule, param := ruleOf(vErr)
+		errs.Add(fieldName(vErr), rule, message(vErr, rule, param))
+	}
+
+	return errs
+}
+
+// fieldName drops the struct name from the namespace, keeping the path of nested fields
+func fieldName(vErr validator.FieldError) string {
+	namespace := vErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+
+	return vErr.Field()
+}
+
+// ruleOf returns the broken rule and its parameter. For alternatives such as "eq=|url",
+// where the first ones only allow an empty value, the last alternative is the one reported
+func ruleOf(vErr validator.FieldError) (string, string) {
+	tag := vErr.Tag()
+	i := strings.LastIndex(tag, "|")
+	if i < 0 {
+		return tag, vErr.Param()
+	}
+
+	rule, param, _ := strings.Cut(tag[i+1:], "=")
+	return rule, param
+}
+
+func message(vErr validator.FieldError, rule, param string) string {
+	switch rule {
+	case "required", "required_if":
+		return "is required"
+	case "min", "max", "len":
+		return lengthMessage(vErr.Kind(), rule, param)
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.Join(strings.Fields(param), ", "))
+	case "eq":
+		return fmt.Sprintf("must be equal to %q", param)
+	case "nefield":
+		// param is the Go name of the other field, which is the JSON name with an uppercase first letter
+		return fmt.Sprintf("must be different from %s", strings.ToLower(param[:1])+param[1:])
+	case "email":
+		return "is not a valid email format"
+	case "url", "http_url":
+		return "is not a valid URL"
+	case "numeric":
+		return "must only contain digits"
+	case "datetime":
+		return fmt.Sprintf("is not a date in the %s format", param)
+	}
+
+	return fmt.Sprintf("failed the %s rule", rule)
+}
+
+func lengthMessage(kind reflect.Kind, rule, param string) string {
+	var unit string
+	switch kind {
+	case reflect.String:
+		unit = " character"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " item"
+	}
+	if unit != "" && param != "1" {
+		unit += "s"
+	}
+
+	switch rule {
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", param, unit)
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", param, unit)
 	}
 
-	return nil
+	return fmt.Sprintf("must be exactly %s%s", param, unit)
 }